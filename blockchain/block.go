@@ -2,54 +2,57 @@ package blockchain
 
 import (
 	"errors"
-	"strings"
-	"time"
 
 	"github.com/jeyoungjung/zerocoin/db"
 	"github.com/jeyoungjung/zerocoin/utils"
+	"github.com/jeyoungjung/zerocoin/wallet"
 )
 
 type Block struct {
+	Version      int    `json:"version"`
 	Hash         string `json:"hash"`
 	PrevHash     string `json:"prevHash,omitempty"`
 	Height       int    `json:"height"`
-	Difficulty   int    `json:"difficulty"`
+	MerkleRoot   string `json:"merkleRoot"`
+	WitnessRoot  string `json:"witnessRoot"`
+	Bits         uint32 `json:"bits"`
 	Nonce        int    `json:"nonce"`
 	Timestamp    int    `json:"timestamp"`
+	Seal         string `json:"seal,omitempty"` // what the consensus proves the block with besides the nonce, like the signature of an authority. not part of the header
 	Transactions []*Tx  `json:"transactions"`
 }
 
-func createBlock(prevHash string, height int, diff int) *Block {
+func createBlock(prevHash string, height int, bits uint32, minTimestamp int) (*Block, error) {
 	block := Block{
-		Hash:       "",
-		PrevHash:   prevHash,
-		Height:     height,
-		Difficulty: diff,
-		Nonce:      0,
+		Version:  blockVersion,
+		Hash:     "",
+		PrevHash: prevHash,
+		Height:   height,
+		Bits:     bits,
+		Nonce:    0,
 	}
-	block.mine()
-	block.Transactions = Mempool().TxToConfirm() // transactions are only confirmed after blocks are mined
-	persistBlock(&block)
-	return &block
+	// transactions are picked before mining, so the merkle root and with it the transactions are covered by the hash
+	coinbaseSize := makeCoinbaseTx(wallet.Wallet().Address, height, 0).size() // the amount is always 8 bytes, so the fees don't change it
+	txs, fees := Mempool().TxToConfirm(maxBlockSize - coinbaseSize)
+	coinbase := makeCoinbaseTx(wallet.Wallet().Address, height, fees) // adds the coinbase transaction right away
+	// coinbase transaction is prepended (appended to the front) https://medium.com/@tzuni_eh/go-append-prepend-item-into-slice-a4bf167eb7af
+	block.Transactions = append([]*Tx{coinbase}, txs...)
+	block.MerkleRoot = merkleRoot(block.Transactions)
+	block.WitnessRoot = witnessRoot(block.Transactions)
+	if err := consensus.Seal(&block, minTimestamp); err != nil {
+		return nil, err
+	}
+	return &block, nil
 }
 
 func persistBlock(b *Block) {
 	db.SaveBlock(b.Hash, utils.EncodeToBytes(b)) // saves the data, hash, prevhash and height in bytes, to the db
 }
 
-// mine is the function where you have to "solve" the "puzzle"
-func (b *Block) mine() {
-	target := strings.Repeat("0", b.Difficulty) // amount of zeros required for the hash; repeated b.difficulty amount of times
-	for {
-		b.Timestamp = int(time.Now().Unix()) // current time since jan 1st 1970, in seconds
-		hash := utils.Hash(b)                // sets the hash value for the block
-		if strings.HasPrefix(hash, target) { // if the hash has the amount of zeros required
-			b.Hash = hash // set the hash and break
-			break
-		} else {
-			b.Nonce++ // increase the Nonce, since Nonce is the only thing the miner can change
-		}
-	}
+// CalculateHash hashes the canonical bytes of the block header,
+// the transactions are covered by the merkle root
+func (b *Block) CalculateHash() string {
+	return utils.HashBytes(b.headerBytes())
 }
 
 func (b *Block) restore(data []byte) {
@@ -67,3 +70,12 @@ func FindBlock(hash string) (*Block, error) {
 	block.restore(BlockBytes)
 	return block, nil
 }
+
+// FindBlockByHeight returns the block at the height of the blockchain
+func FindBlockByHeight(height int) (*Block, error) {
+	hash := db.GetHashByHeight(height)
+	if hash == "" {
+		return nil, ErrBlockNotFound
+	}
+	return FindBlock(hash)
+}
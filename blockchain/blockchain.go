@@ -2,6 +2,7 @@ package blockchain
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"sync"
 
@@ -9,18 +10,11 @@ import (
 	"github.com/jeyoungjung/zerocoin/utils"
 )
 
-const (
-	defaultDifficulty              int = 2 // set to have 2 leading zeros
-	blocksRequiredForRecalculation int = 5 // checked every 5 blocks
-	expectedMineTime               int = 2 // should take around 2 minutes per block
-	allowedRange                   int = 2 // allowed +- 2 minutes (8 to 12 minutes every 5 blocks)
-)
-
 type blockchain struct {
-	NewestHash        string `json:"newestHash"`
-	Height            int    `json:"height"`
-	CurrentDifficulty int    `json:"currentdifficulty"`
-	m                 sync.Mutex
+	NewestHash  string `json:"newestHash"`
+	Height      int    `json:"height"`
+	CurrentBits uint32 `json:"currentBits"`
+	m           sync.Mutex
 }
 
 var b *blockchain
@@ -37,9 +31,17 @@ func Blockchain() *blockchain {
 
 		checkpoint := db.GetCheckpointData()
 		if checkpoint == nil { // if there is no checkpoint make a genesis block
-			b.AddBlock()
+			_, err := b.AddBlock()
+			utils.HandleErr(err)
 		} else { // if there is checkpoint, restore that block
 			b.restore(checkpoint)
+			if newest := newestBlock(b); newest.Version < blockVersion { // its blocks can't be validated or built on anymore
+				utils.HandleErr(fmt.Errorf("%s has version %d blocks but this version of zerocoin needs version %d, delete it to reset the database", db.DbName(), newest.Version, blockVersion))
+			}
+			if db.GetUTxOTip() != b.NewestHash || db.GetHashByHeight(b.Height) != b.NewestHash { // the indexes are not up to date with the blocks
+				rebuildIndexes(b)
+			}
+			restoreMempool(b)
 		}
 	})
 	return b
@@ -51,13 +53,27 @@ func Status(b *blockchain, rw http.ResponseWriter) {
 	utils.HandleErr(json.NewEncoder(rw).Encode(b))
 }
 
-func (b *blockchain) AddBlock() *Block {
-	block := createBlock(b.NewestHash, b.Height+1, getDifficulty(b))
-	b.NewestHash = block.Hash // newesthash, height and currentdifficulty is updated every time a new block is created
-	b.Height = block.Height
-	b.CurrentDifficulty = block.Difficulty
-	persistBlockchain(b)
-	return block
+// AddBlock mines a new block on top of the newest block and adds it to the blockchain
+func (b *blockchain) AddBlock() (*Block, error) {
+	b.m.Lock()
+	parent := newestBlock(b)
+	b.m.Unlock()
+	prevHash, height, minTimestamp := "", 1, 0
+	if parent != nil {
+		prevHash, height, minTimestamp = parent.Hash, parent.Height+1, medianTimePast(parent)+1
+	}
+	bits, err := consensus.NextBits(parent)
+	if err != nil {
+		return nil, err
+	}
+	block, err := createBlock(prevHash, height, bits, minTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.addBlock(block); err != nil {
+		return nil, err
+	}
+	return block, nil
 }
 
 func (b *blockchain) restore(data []byte) {
@@ -70,83 +86,92 @@ func persistBlockchain(b *blockchain) {
 
 // GetBlockchain gets every block from the blockchain
 func GetBlockchain(b *blockchain) []*Block {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return blocks(b)
+}
+
+// GetBlocksFrom gets up to limit blocks, starting at the height from and going towards the genesis block
+func GetBlocksFrom(b *blockchain, from, limit int) []*Block {
 	b.m.Lock()
 	defer b.m.Unlock()
 	var blocks []*Block
-	hashCursor := b.NewestHash // start from the newest hash
-	for {
-		block, _ := FindBlock(hashCursor) // find the block with the hashcursor
-		blocks = append(blocks, block)    // add it to the blocks
-		if block.PrevHash != "" {         // if there is prevhash, make the hashcursor be the prevhash
-			hashCursor = block.PrevHash
-		} else { // if there's no prevhash, meaning, the genesis block
-			break
+	for height := from; height > 0 && height > from-limit; height-- {
+		block, err := FindBlockByHeight(height)
+		if err != nil { // from is higher than the newest block
+			continue
 		}
+		blocks = append(blocks, block)
 	}
 	return blocks
 }
 
-func getDifficulty(b *blockchain) int {
-	if b.Height == 0 { // if there is no block, just set the difficulty to default difficulty
-		return defaultDifficulty
-	} else if b.Height%blocksRequiredForRecalculation == 0 { // we are recalculating every 5 blocks
-		// (it's just what we set it to, bitcoin has it set to 2016, since they hopefully want to check every 2 weeks, and they want 1 block every 10 min, 1*6*24*14 = 2016)
-		// , recalculate the difficulty
-		return recalculateDifficulty(b)
-	} else { // anything else, just return the current difficulty
-		return b.CurrentDifficulty
+// blocks does the same thing as GetBlockchain but without locking,
+// so it can be used by functions that are already holding the lock
+func blocks(b *blockchain) []*Block {
+	var blocks []*Block
+	hashCursor := b.NewestHash // start from the newest hash
+	for hashCursor != "" {     // the genesis block has no prevhash, so the loop stops after it
+		block, err := FindBlock(hashCursor) // find the block with the hashcursor
+		utils.HandleErr(err)
+		blocks = append(blocks, block) // add it to the blocks
+		hashCursor = block.PrevHash    // go to the previous block
 	}
+	return blocks
 }
 
-func recalculateDifficulty(b *blockchain) int {
-	allBlocks := GetBlockchain(b)                                                // gets every block
-	newestBlock := allBlocks[0]                                                  // newest block added
-	lastRecalculatedBlock := allBlocks[blocksRequiredForRecalculation-1]         // gets the 5th newest block
-	actualTime := (newestBlock.Timestamp - lastRecalculatedBlock.Timestamp) / 60 // actual time took to mine 5 blocks
-	expectedTime := blocksRequiredForRecalculation * expectedMineTime            // time that should've taken to mine 5 blocks
-	if actualTime <= (expectedTime - allowedRange) {                             // if it took less than 8 minutes
-		return b.CurrentDifficulty + 1 // increase difficulty because it took shorter than expected
-	} else if actualTime >= (expectedTime + allowedRange) { // if it took more than 12 minutes
-		return b.CurrentDifficulty - 1 // decrease difficulty because it took longer than expected
+// newestBlock returns the newest block, or nil if there are no blocks yet
+func newestBlock(b *blockchain) *Block {
+	if b.NewestHash == "" {
+		return nil
 	}
-	return b.CurrentDifficulty // if its in range, return the current difficulty
+	block, err := FindBlock(b.NewestHash)
+	utils.HandleErr(err)
+	return block
 }
 
-// Replace empties the current blockchain and replaces it with the new blockchain
-func (b *blockchain) Replace(newBlockchain []*Block) {
+// HasMoreWork tells if our chain has more work than the chain ending at the stored block with the hash.
+// it's how the newest blocks of two nodes are compared, a chain with fewer blocks can still have more work
+func HasMoreWork(b *blockchain, hash string) bool {
 	b.m.Lock()
 	defer b.m.Unlock()
-	b.CurrentDifficulty = newBlockchain[0].Difficulty
-	b.Height = len(newBlockchain)
-	b.NewestHash = newBlockchain[0].Hash
-	db.EmptyBlocksBucket()
-	persistBlockchain(b)
-	for _, block := range newBlockchain {
-		persistBlock(block)
+	return chainWork(b.NewestHash).Cmp(chainWork(hash)) > 0
+}
+
+// AddPeerBlocks adds every block of a peer's blockchain, sent from the newest to the oldest block
+// blocks we already have are skipped, and the chain with the most work becomes our blockchain
+func (b *blockchain) AddPeerBlocks(newBlocks []*Block) error {
+	for i := len(newBlocks) - 1; i >= 0; i-- { // parents have to be added before their children
+		err := b.AddPeerBlock(newBlocks[i])
+		if err != nil && err != ErrBlockKnown {
+			return err
+		}
 	}
+	return nil
 }
 
 // AddPeerBlock adds the new block from the peer to the current blockchain
 // AddPeerBlock is called everytime a new block is made by someone
-func (b *blockchain) AddPeerBlock(newBlock *Block) {
+// if the block is not valid it returns the reason and the blockchain is left untouched
+func (b *blockchain) AddPeerBlock(newBlock *Block) error {
+	return b.addBlock(newBlock)
+}
 
+// addBlock stores the block and, if its chain has more work than ours, reorganizes the blockchain to end at it
+func (b *blockchain) addBlock(newBlock *Block) error {
 	b.m.Lock()
-	m.m.Lock()
+	Mempool().m.Lock() // Mempool() makes sure the mempool exists, even if this node never made a transaction
+	// (the reorganize functions use m directly)
 	defer b.m.Unlock()
 	defer m.m.Unlock()
 
-	b.CurrentDifficulty = newBlock.Difficulty
-	b.Height += 1
-	b.NewestHash = newBlock.Hash
-
-	persistBlockchain(b)
-	persistBlock(newBlock)
-
-	for _, tx := range newBlock.Transactions { // if the transaction inside the current mempool is resolved by the
-		// new incoming block, delete the transaction from the current mempool
-		_, ok := m.Txs[tx.ID]
-		if ok {
-			delete(m.Txs, tx.ID)
-		}
+	if err := acceptBlock(newBlock); err != nil {
+		return err
+	}
+	if chainWork(newBlock.Hash).Cmp(chainWork(b.NewestHash)) <= 0 { // a side branch, keep it in case it gets longer
+		return nil
 	}
+	err := reorganize(b, newBlock)
+	persistBlockchain(b)
+	return err
 }
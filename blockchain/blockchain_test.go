@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"flag"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/jeyoungjung/zerocoin/db"
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+// testConsensus seals a block without any work, so the tests don't wait on mining.
+// every block counts the same, so the branch with more blocks has more work
+type testConsensus struct{}
+
+func (testConsensus) NextBits(parent *Block) (uint32, error) {
+	return powLimitBits, nil
+}
+
+func (testConsensus) Seal(block *Block, minTimestamp int) error {
+	block.Timestamp = minTimestamp
+	block.Hash = block.CalculateHash()
+	return nil
+}
+
+func (testConsensus) VerifySeal(block *Block, parent *Block) error {
+	if block.Hash != block.CalculateHash() {
+		return ErrInvalidBlockHash
+	}
+	return ValidateTimestamp(block, parent)
+}
+
+func (testConsensus) Work(block *Block) *big.Int {
+	return big.NewInt(1)
+}
+
+// TestMain runs the tests in a new directory, so the database and the wallet they make are thrown away after
+func TestMain(tests *testing.M) {
+	flag.Parse()
+	dir, err := os.MkdirTemp("", "zerocoin")
+	utils.HandleErr(err)
+	utils.HandleErr(os.Chdir(dir))
+	os.Args = []string{os.Args[0], "-port=0", "-port=0"} // db.DbName reads the port from the arguments
+	db.InitDB()
+	SetConsensus(testConsensus{})
+	code := tests.Run()
+	db.CloseDatabase()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// addBlocks adds n blocks paying our wallet on top of the newest block
+func addBlocks(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := Blockchain().AddBlock(); err != nil {
+			t.Fatalf("adding a block: %v", err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"math/big"
+)
+
+// Consensus decides who can add the next block and how hard it is to do.
+// the chain only talks to it through these methods, so another engine can be used without changing the rest of the package.
+// the version, height, merkle roots and transactions of a block are checked by the chain, everything else by the engine
+type Consensus interface {
+	// NextBits returns the bits the block after parent has to have, parent is nil for the genesis block.
+	// for proof of work it's the difficulty, an engine with authorities can use it for whose turn it is.
+	// it returns an error if there are no bits the block can be sealed with
+	NextBits(parent *Block) (uint32, error)
+	// Seal sets the timestamp, the nonce, the seal and the hash of the block, everything else is already filled in.
+	// the timestamp can't be older than minTimestamp. the hash is how the block is stored and linked,
+	// so it has to be lowercase hex covering the header (CalculateHash) and the seal.
+	// it returns an error instead of sealing a block that could never be valid
+	Seal(block *Block, minTimestamp int) error
+	// VerifySeal checks the hash, the seal and the timestamp of the block on top of parent, parent is nil for the genesis block
+	VerifySeal(block *Block, parent *Block) error
+	// Work is how much the block counts when picking the chain with the most work
+	Work(block *Block) *big.Int
+}
+
+// ProofOfWork is the default consensus, a block is sealed by finding a nonce that makes its hash not bigger than the target.
+// the target is recalculated for every block from the newest blocks, with the parameters below. the ones left at 0 use the defaults
+type ProofOfWork struct {
+	MineTime     int // seconds a block should take, 2 minutes by default
+	Window       int // how many of the newest blocks the target is calculated from, 45 by default
+	MaxSolveTime int // seconds one slow block (or a lying timestamp) can count for at most, 6 times MineTime by default
+}
+
+var consensus Consensus = ProofOfWork{}
+
+// SetConsensus replaces the consensus of the chain, it has to be called before Blockchain() makes or restores the chain.
+// every node of the network has to use the same one
+func SetConsensus(c Consensus) {
+	consensus = c
+}
+
+// NextBits is the target of the LWMA of the newest blocks
+func (p ProofOfWork) NextBits(parent *Block) (uint32, error) {
+	return p.getBits(parent)
+}
+
+// Seal is the function where you have to "solve" the "puzzle"
+func (ProofOfWork) Seal(block *Block, minTimestamp int) error {
+	if !validTarget(block.Bits) { // no hash is under a target of 0, it would never stop
+		return ErrInvalidTarget
+	}
+	for {
+		block.Timestamp = AdjustedTime() // network time since jan 1st 1970, in seconds
+		if block.Timestamp < minTimestamp {
+			block.Timestamp = minTimestamp
+		}
+		hash := block.CalculateHash()        // sets the hash value for the block
+		if hasValidProof(hash, block.Bits) { // if the hash is not bigger than the target
+			block.Hash = hash // set the hash and stop
+			return nil
+		} else {
+			block.Nonce++ // increase the Nonce, since Nonce is the only thing the miner can change
+		}
+	}
+}
+
+// VerifySeal checks that the hash is the hash of the header and not bigger than the target of the bits.
+// the work is all in the hash, so there is no seal
+func (ProofOfWork) VerifySeal(block *Block, parent *Block) error {
+	if block.Seal != "" { // the hash doesn't cover it, so anyone could change it
+		return ErrInvalidSeal
+	}
+	if block.Hash != block.CalculateHash() {
+		return ErrInvalidBlockHash
+	}
+	if !hasValidProof(block.Hash, block.Bits) {
+		return ErrInvalidProofOfWork
+	}
+	return ValidateTimestamp(block, parent)
+}
+
+// Work is the amount of hashes it takes on average to mine the block
+func (ProofOfWork) Work(block *Block) *big.Int {
+	return blockWork(block)
+}
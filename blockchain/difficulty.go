@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+)
+
+// a block is mined when its hash, read as a 256 bit number, is not bigger than the target.
+// the target is kept in the header as "bits": the first byte is the length of the target in bytes,
+// and the other 3 bytes are the first 3 bytes of the target (same as bitcoin's nBits)
+const (
+	powLimitBits      uint32 = 0x207fffff // the easiest target there can be
+	defaultBits       uint32 = 0x2000ffff // the target of the genesis block, about the same as 2 leading zeros
+	defaultMineTime   int    = 2 * 60     // should take around 2 minutes per block, in seconds
+	defaultLWMAWindow int    = 45         // how many of the newest blocks the target is calculated from
+	solveTimeLimit    int    = 6          // by default one block can't count for more than this many times the mine time
+)
+
+// withDefaults fills in the retarget parameters that were left at 0
+func (p ProofOfWork) withDefaults() ProofOfWork {
+	if p.MineTime <= 0 {
+		p.MineTime = defaultMineTime
+	}
+	if p.Window <= 0 {
+		p.Window = defaultLWMAWindow
+	}
+	if p.MaxSolveTime <= 0 {
+		p.MaxSolveTime = solveTimeLimit * p.MineTime
+	}
+	return p
+}
+
+// ErrInvalidTarget is returned instead of mining with bits that no hash can be under, or that are easier than the limit
+var ErrInvalidTarget = errors.New("bits are not a target between 1 and the easiest target")
+
+// compactToTarget turns bits into the target. bits with the sign bit set are not a valid target, so they give 0
+func compactToTarget(bits uint32) *big.Int {
+	exponent := uint(bits >> 24)
+	mantissa := int64(bits & 0x007fffff)
+	if bits&0x00800000 != 0 {
+		return big.NewInt(0)
+	}
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		return target.Rsh(target, 8*(3-exponent))
+	}
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// targetToCompact turns the target into bits, only the first 3 bytes of the target are kept
+func targetToCompact(target *big.Int) uint32 {
+	size := uint((target.BitLen() + 7) / 8)
+	var mantissa uint64
+	if size <= 3 {
+		mantissa = target.Uint64() << (8 * (3 - size))
+	} else {
+		mantissa = new(big.Int).Rsh(target, 8*(size-3)).Uint64()
+	}
+	if mantissa&0x00800000 != 0 { // the first bit is the sign bit, so move everything a byte down
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size)<<24 | uint32(mantissa)
+}
+
+// validTarget checks that the bits can be mined with and are not easier than powLimitBits
+func validTarget(bits uint32) bool {
+	target := compactToTarget(bits)
+	return target.Sign() > 0 && target.Cmp(compactToTarget(powLimitBits)) <= 0
+}
+
+// hasValidProof checks if the hash is not bigger than the target of the bits
+func hasValidProof(hash string, bits uint32) bool {
+	hashNumber, ok := new(big.Int).SetString(hash, 16)
+	if !ok {
+		return false
+	}
+	target := compactToTarget(bits)
+	return target.Sign() > 0 && hashNumber.Cmp(target) <= 0
+}
+
+// blockWork is the amount of hashes it takes on average to mine the block, 2^256 / (target + 1)
+func blockWork(block *Block) *big.Int {
+	target := compactToTarget(block.Bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), 256)
+	return max.Div(max, target.Add(target, big.NewInt(1)))
+}
+
+// getBits returns the bits the block after the parent has to be mined with
+// parent is nil for the genesis block. the bits come from the bits of stored blocks,
+// so blocks with a broken target (like the blocks of an older version, which had no bits) give an error
+func (p ProofOfWork) getBits(parent *Block) (uint32, error) {
+	if parent == nil { // if there is no block, just use the default target
+		return defaultBits, nil
+	}
+	bits := p.recalculateBits(parent)
+	if !validTarget(bits) {
+		return 0, ErrInvalidTarget
+	}
+	return bits, nil
+}
+
+// recalculateBits is a linearly weighted moving average (LWMA) of the newest p.Window blocks.
+// it is recalculated for every block. the average target is scaled by how long the blocks actually took
+// compared to how long they should've taken, and newer blocks count more, so the target reacts quickly
+// without jumping around because of one block
+func (p ProofOfWork) recalculateBits(newestBlock *Block) uint32 {
+	p = p.withDefaults()
+	window := []*Block{newestBlock} // from the newest block back to p.Window blocks before it
+	for len(window) <= p.Window && window[len(window)-1].PrevHash != "" {
+		parent, err := parentOf(window[len(window)-1])
+		if err != nil { // same as medianTimePast, acceptBlock already checked the blocks are there
+			break
+		}
+		window = append(window, parent)
+	}
+	n := len(window) - 1 // every block except the oldest one has a solve time
+	if n == 0 {          // only the genesis block, nothing to measure yet
+		return newestBlock.Bits
+	}
+	sumTargets := big.NewInt(0)
+	weightedSolveTimes := 0
+	for i := 1; i <= n; i++ { // i is the weight, the oldest block is 1 and the newest block is n
+		block, previous := window[n-i], window[n-i+1]
+		solveTime := block.Timestamp - previous.Timestamp // can be negative, timestamps only have to be after the median time
+		if solveTime > p.MaxSolveTime {
+			solveTime = p.MaxSolveTime
+		} else if solveTime < -p.MaxSolveTime {
+			solveTime = -p.MaxSolveTime
+		}
+		weightedSolveTimes += i * solveTime
+		sumTargets.Add(sumTargets, compactToTarget(block.Bits))
+	}
+	expected := n * (n + 1) / 2 * p.MineTime // what weightedSolveTimes would be if every block took p.MineTime
+	if weightedSolveTimes < expected/10 {    // the target can't get more than 10 times harder at once
+		weightedSolveTimes = expected / 10
+	}
+	target := sumTargets.Div(sumTargets, big.NewInt(int64(n))) // average target of the window
+	target.Mul(target, big.NewInt(int64(weightedSolveTimes)))
+	target.Div(target, big.NewInt(int64(expected)))
+	if powLimit := compactToTarget(powLimitBits); target.Cmp(powLimit) > 0 {
+		target = powLimit
+	}
+	return targetToCompact(target)
+}
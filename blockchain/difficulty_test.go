@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompactToTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		bits   uint32
+		target *big.Int
+	}{
+		{"the easiest target", powLimitBits, new(big.Int).Lsh(big.NewInt(0x7fffff), 8*29)},
+		{"the genesis target", defaultBits, new(big.Int).Lsh(big.NewInt(0xffff), 8*29)},
+		{"3 bytes", 0x03123456, big.NewInt(0x123456)},
+		{"2 bytes keep the first 2 bytes of the mantissa", 0x02123456, big.NewInt(0x1234)},
+		{"1 byte keeps the first byte of the mantissa", 0x01123456, big.NewInt(0x12)},
+		{"1 byte with a first byte of 0 truncates to 0", 0x01003456, big.NewInt(0)},
+		{"0 bytes truncate to 0", 0x00123456, big.NewInt(0)},
+		{"the sign bit is not a target", 0x04923456, big.NewInt(0)},
+	}
+	for _, test := range tests {
+		if got := compactToTarget(test.bits); got.Cmp(test.target) != 0 {
+			t.Errorf("%s: got %x for %08x, want %x", test.name, got, test.bits, test.target)
+		}
+	}
+}
+
+func TestTargetToCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		target *big.Int
+		bits   uint32
+	}{
+		{"0", big.NewInt(0), 0},
+		{"1 byte", big.NewInt(0x12), 0x01120000},
+		{"1 byte with the sign bit moves a byte down", big.NewInt(0x80), 0x02008000},
+		{"3 bytes", big.NewInt(0x123456), 0x03123456},
+		{"more than 3 bytes only keeps 3", big.NewInt(0x123456789a), 0x05123456},
+		{"the genesis target", compactToTarget(defaultBits), defaultBits},
+		{"the easiest target", compactToTarget(powLimitBits), powLimitBits},
+	}
+	for _, test := range tests {
+		bits := targetToCompact(test.target)
+		if bits != test.bits {
+			t.Errorf("%s: got %08x for %x, want %08x", test.name, bits, test.target, test.bits)
+		}
+		// what comes back is the target with everything after its first 3 bytes cut off
+		size := uint((test.target.BitLen() + 7) / 8)
+		want := new(big.Int).Set(test.target)
+		if size > 3 {
+			want.Rsh(want, 8*(size-3)).Lsh(want, 8*(size-3))
+		}
+		if got := compactToTarget(bits); got.Cmp(want) != 0 {
+			t.Errorf("%s: got %x back from %08x, want %x", test.name, got, bits, want)
+		}
+	}
+}
+
+func TestInvalidTargetIsNotMined(t *testing.T) {
+	tests := []struct {
+		bits  uint32
+		valid bool
+	}{
+		{0, false}, // the bits of the blocks before there were bits
+		{0x01003456, false},
+		{0x04923456, false},
+		{0x21010000, false}, // 2^256, easier than powLimitBits
+		{powLimitBits, true},
+		{defaultBits, true},
+	}
+	for _, test := range tests {
+		if validTarget(test.bits) != test.valid {
+			t.Errorf("got %v for %08x, want %v", !test.valid, test.bits, test.valid)
+		}
+		if test.valid {
+			continue
+		}
+		if err := (ProofOfWork{}).Seal(&Block{Bits: test.bits}, 0); err != ErrInvalidTarget {
+			t.Errorf("got %v sealing with %08x, want %v", err, test.bits, ErrInvalidTarget)
+		}
+		// the genesis block is the whole window, so the next bits are its bits
+		if _, err := (ProofOfWork{}).NextBits(&Block{Height: 1, Bits: test.bits}); err != ErrInvalidTarget {
+			t.Errorf("got %v for the bits after a block with %08x, want %v", err, test.bits, ErrInvalidTarget)
+		}
+	}
+}
+
+// storeWindow stores a chain of blocks with the bits, each one solveTimes[i] seconds after the one before, and returns the newest.
+// they are only stored, not connected, which is all recalculateBits looks at
+func storeWindow(bits uint32, solveTimes []int) *Block {
+	block := &Block{Version: blockVersion, Height: 1, Bits: bits, Timestamp: 1700000000}
+	block.Hash = block.CalculateHash()
+	persistBlock(block)
+	for _, solveTime := range solveTimes {
+		block = &Block{Version: blockVersion, PrevHash: block.Hash, Height: block.Height + 1, Bits: bits, Timestamp: block.Timestamp + solveTime}
+		block.Hash = block.CalculateHash()
+		persistBlock(block)
+	}
+	return block
+}
+
+func repeat(solveTime, n int) []int {
+	solveTimes := make([]int, n)
+	for i := range solveTimes {
+		solveTimes[i] = solveTime
+	}
+	return solveTimes
+}
+
+func TestLWMABounds(t *testing.T) {
+	const bits uint32 = 0x1f00ffff
+	target := compactToTarget(bits)
+	scaled := func(num, den int64) uint32 { // the target times num / den
+		scaled := new(big.Int).Mul(target, big.NewInt(num))
+		return targetToCompact(scaled.Div(scaled, big.NewInt(den)))
+	}
+	pow := ProofOfWork{}.withDefaults()
+	tests := []struct {
+		name       string
+		pow        ProofOfWork
+		bits       uint32
+		solveTimes []int
+		want       uint32
+	}{
+		{"only the genesis block keeps its bits", pow, bits, nil, bits},
+		{"blocks on time keep the target", pow, bits, repeat(pow.MineTime, pow.Window), bits},
+		{"blocks twice as slow double it", pow, bits, repeat(2*pow.MineTime, pow.Window), scaled(2, 1)},
+		{"blocks in no time make it 10 times harder at most", pow, bits, repeat(0, pow.Window), scaled(1, 10)},
+		{"blocks from the past count as no time", pow, bits, repeat(-pow.MineTime, pow.Window), scaled(1, 10)},
+		{"a slow block counts for MaxSolveTime at most", pow, bits, repeat(100*pow.MineTime, pow.Window), scaled(int64(solveTimeLimit), 1)},
+		{"it can't get easier than the limit", pow, powLimitBits, repeat(100*pow.MineTime, pow.Window), powLimitBits},
+		{"only the window counts", ProofOfWork{Window: 5},
+			bits, append(repeat(100*pow.MineTime, 20), repeat(pow.MineTime, 5)...), bits},
+		{"a shorter mine time makes on time blocks slow", ProofOfWork{MineTime: pow.MineTime / 2},
+			bits, repeat(pow.MineTime, pow.Window), scaled(2, 1)},
+		{"a lower MaxSolveTime", ProofOfWork{MaxSolveTime: 2 * pow.MineTime},
+			bits, repeat(100*pow.MineTime, pow.Window), scaled(2, 1)},
+	}
+	for _, test := range tests {
+		got := test.pow.recalculateBits(storeWindow(test.bits, test.solveTimes))
+		if got != test.want {
+			t.Errorf("%s: got %08x, want %08x", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+// the layout of each version is written down in docs/serialization.md,
+// any change to the bytes below needs a new version there
+const (
+	blockVersion int = 3 // version 2 replaced the difficulty with the bits, version 3 added the witness root
+	// version 2 added the lock time and the relative locks of the inputs, version 3 the locking scripts of the outputs,
+	// version 4 the signature hash of every input
+	txVersion int = 4
+)
+
+var ErrUnknownVersion = errors.New("unknown block or transaction version")
+
+// encoder writes the canonical bytes: integers are big endian, strings are prefixed by their length
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint32(v int) {
+	binary.Write(&e.buf, binary.BigEndian, uint32(v))
+}
+
+func (e *encoder) int64(v int) {
+	binary.Write(&e.buf, binary.BigEndian, int64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(len(s))
+	e.buf.WriteString(s)
+}
+
+// headerBytes is what gets hashed while mining. the transactions are covered by the merkle root,
+// and their signatures by the witness root
+func (b *Block) headerBytes() []byte {
+	e := &encoder{}
+	e.uint32(b.Version)
+	e.string(b.PrevHash)
+	e.int64(b.Height)
+	e.string(b.MerkleRoot)
+	if b.Version >= 3 {
+		e.string(b.WitnessRoot)
+	}
+	e.uint32(int(b.Bits))
+	e.int64(b.Nonce)
+	e.int64(b.Timestamp)
+	return e.buf.Bytes()
+}
+
+// encode writes the transaction, with or without the signatures of its inputs
+func (t *Tx) encode(withSignatures bool) []byte {
+	e := &encoder{}
+	e.uint32(t.Version)
+	e.int64(t.Timestamp)
+	if t.Version >= 2 {
+		e.int64(t.LockTime)
+	}
+	e.uint32(len(t.TxIns))
+	for _, txIn := range t.TxIns {
+		e.string(txIn.TxID)
+		e.int64(txIn.Index)
+		if t.Version >= 2 {
+			e.int64(txIn.LockBlocks)
+			e.int64(txIn.LockSeconds)
+		}
+		if withSignatures {
+			e.string(txIn.Signature)
+		} else {
+			e.string("") // the signatures (unlocking scripts) are made after the id, so they are left empty when hashing the id
+		}
+	}
+	e.uint32(len(t.TxOuts))
+	for _, txOut := range t.TxOuts {
+		e.string(txOut.Address)
+		e.int64(txOut.Amount)
+		if t.Version >= 3 {
+			e.string(txOut.Script)
+		}
+	}
+	return e.buf.Bytes()
+}
+
+// sigHash is what the signatures of the input at index sign: the bytes of the id, which cover every outpoint and output,
+// followed by the index, so a signature can't be moved to another input spending from the same key.
+// it only needs the transaction, so any node can check a signature without knowing how it was made.
+// before version 4 every input signed the id
+func (t *Tx) sigHash(index int) string {
+	if t.Version < 4 {
+		return t.ID
+	}
+	e := &encoder{}
+	e.buf.Write(t.encode(false))
+	e.uint32(index)
+	return utils.HashBytes(e.buf.Bytes())
+}
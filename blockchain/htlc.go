@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jeyoungjung/zerocoin/db"
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+var (
+	ErrNotHTLC          = errors.New("output is not locked by an htlc")
+	ErrNotHTLCRecipient = errors.New("our wallet is not the recipient of the htlc")
+	ErrNotHTLCSender    = errors.New("our wallet is not the sender of the htlc")
+	ErrWrongPreimage    = errors.New("preimage must be 32 bytes of hex hashing to the hash of the htlc")
+)
+
+// HTLC is an output locked by an htlc script, and how it was spent if it was
+type HTLC struct {
+	TxID      string `json:"txid"`
+	Index     int    `json:"index"`
+	Amount    int    `json:"amount"`
+	Address   string `json:"address"`
+	Hash      string `json:"hash"`
+	Recipient string `json:"recipient"`
+	Sender    string `json:"sender"`
+	Timeout   int    `json:"timeout"`
+	SpentBy   string `json:"spentBy,omitempty"`   // the transaction that redeemed or refunded it, confirmed or in the mempool
+	Preimage  string `json:"preimage,omitempty"`  // what the recipient revealed to redeem it
+	Refunded  bool   `json:"refunded,omitempty"`  // the sender took it back
+	Confirmed bool   `json:"confirmed,omitempty"` // the spending transaction is in a block
+}
+
+// AddHTLC locks amount to an htlc paying recipient for the data hashing to hash, or our wallet back from timeout on.
+// it returns the htlc and the transaction that made it
+func (m *mempool) AddHTLC(recipient, hash string, timeout, amount, fee, feeRate int) (*HTLC, *Tx, error) {
+	template := ScriptTemplate{Type: "htlc", PubKeys: []string{recipient, wallet.Wallet().Address}, Hash: hash, Timeout: timeout}
+	script, err := template.Script()
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := m.AddTx([]*TxOut{{Address: ScriptAddress(script), Amount: amount, Script: script}}, fee, feeRate, TxLocks{})
+	if err != nil {
+		return nil, nil, err
+	}
+	index := len(tx.TxOuts) - 1 // the payments come after the change
+	htlc, _ := newHTLC(&unspentOutput{TxID: tx.ID, Index: index, Output: tx.TxOuts[index]})
+	return htlc, tx, nil
+}
+
+// RedeemHTLC takes the htlc output at txID:index to our wallet by revealing the preimage of its hash
+func (m *mempool) RedeemHTLC(txID string, index int, preimage string, fee, feeRate int) (*Tx, error) {
+	data := decodeHex(preimage)
+	hashed := sha256.Sum256(data)
+	return m.spendHTLC(txID, index, fee, feeRate, func(htlc *HTLC) (string, int, error) {
+		if htlc.Recipient != wallet.Wallet().Address {
+			return "", 0, ErrNotHTLCRecipient
+		}
+		// the same size as the other chain's, so a preimage can't be valid on one side and too big on the other
+		if len(data) != 32 || hex.EncodeToString(hashed[:]) != htlc.Hash {
+			return "", 0, ErrWrongPreimage
+		}
+		return fmt.Sprintf("%s %s", hex.EncodeToString(data), numberOp(1)), 0, nil
+	})
+}
+
+// RefundHTLC takes the htlc output at txID:index back to our wallet, the transaction is rejected until the timeout has passed
+func (m *mempool) RefundHTLC(txID string, index int, fee, feeRate int) (*Tx, error) {
+	return m.spendHTLC(txID, index, fee, feeRate, func(htlc *HTLC) (string, int, error) {
+		if htlc.Sender != wallet.Wallet().Address {
+			return "", 0, ErrNotHTLCSender
+		}
+		return numberOp(0), htlc.Timeout, nil
+	})
+}
+
+// spendHTLC sends the whole htlc output to our wallet minus the fee.
+// unlock checks that we can spend it and returns what goes after the signature in the unlocking script and the lock time it needs
+func (m *mempool) spendHTLC(txID string, index int, fee, feeRate int, unlock func(htlc *HTLC) (string, int, error)) (*Tx, error) {
+	if fee < 0 || feeRate < 0 {
+		return nil, ErrorInvalidFee
+	}
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	prev := m.lookup(txID, index)
+	if prev == nil {
+		return nil, ErrTxMissingInput
+	}
+	htlc, ok := newHTLC(prev)
+	if !ok {
+		return nil, ErrNotHTLC
+	}
+	rest, lockTime, err := unlock(htlc)
+	if err != nil {
+		return nil, err
+	}
+	from := wallet.Wallet().Address
+	for {
+		if fee >= prev.Output.Amount {
+			return nil, ErrorNoMoney
+		}
+		tx := &Tx{
+			Version:   txVersion,
+			Timestamp: int(time.Now().Unix()),
+			LockTime:  lockTime,
+			TxIns:     []*TxIn{{TxID: txID, Index: index, Signature: fmt.Sprintf("%s %s", from, rest)}}, // the address is as long as a signature
+			TxOuts:    []*TxOut{{Address: from, Amount: prev.Output.Amount - fee}},
+		}
+		if neededFee := feeForSize(feeRate, tx.size()); neededFee > fee {
+			fee = neededFee
+			continue
+		}
+		tx.hashId()
+		tx.TxIns[0].Signature = fmt.Sprintf("%s %s", wallet.Sign(tx.sigHash(0), wallet.Wallet()), rest)
+		if err := addToMempool(b, tx); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+}
+
+// newHTLC reads the htlc locking the output, ok is false if it's not an htlc
+func newHTLC(u *unspentOutput) (*HTLC, bool) {
+	hash, recipient, sender, timeout, ok := parseHTLC(u.Output.Script)
+	if !ok {
+		return nil, false
+	}
+	return &HTLC{
+		TxID:      u.TxID,
+		Index:     u.Index,
+		Amount:    u.Output.Amount,
+		Address:   u.Output.Address,
+		Hash:      hash,
+		Recipient: recipient,
+		Sender:    sender,
+		Timeout:   timeout,
+	}, true
+}
+
+// FindHTLC returns the htlc output at txID:index and how it was spent.
+// once the recipient redeems it, the preimage is in the unlocking script for anyone to read,
+// so the other side of a swap can use it to redeem theirs
+func FindHTLC(b *blockchain, txID string, index int) (*HTLC, error) {
+	status, err := FindTxStatus(b, txID)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(status.Tx.TxOuts) {
+		return nil, ErrTxMissingInput
+	}
+	htlc, ok := newHTLC(&unspentOutput{TxID: txID, Index: index, Output: status.Tx.TxOuts[index]})
+	if !ok {
+		return nil, ErrNotHTLC
+	}
+	var spender *Tx
+	if id := db.GetTxSpender(outpointKey(txID, index)); id != "" {
+		spender = FindTx(b, id)
+		htlc.Confirmed = true
+	} else {
+		spender = Mempool().spenderOf(txID, index)
+	}
+	if spender == nil {
+		return htlc, nil
+	}
+	htlc.SpentBy = spender.ID
+	for _, txIn := range spender.TxIns {
+		if txIn.TxID != txID || txIn.Index != index {
+			continue
+		}
+		tokens, err := parseScript(txIn.Signature)
+		if err != nil {
+			break
+		}
+		switch {
+		case len(tokens) == 3 && tokens[2].op == numberOp(1): // signature, preimage, OP_1
+			htlc.Preimage = hex.EncodeToString(tokens[1].data)
+		case len(tokens) == 2 && tokens[1].op == numberOp(0): // signature, OP_0
+			htlc.Refunded = true
+		}
+	}
+	return htlc, nil
+}
+
+// spenderOf returns the transaction of the mempool spending txID:index, or nil
+func (m *mempool) spenderOf(txID string, index int) *Tx {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, tx := range m.Txs {
+		for _, txIn := range tx.TxIns {
+			if txIn.TxID == txID && txIn.Index == index {
+				return tx
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package blockchain
+
+const (
+	lockTimeThreshold int = 500000000 // a lock time below this is a block height, from this on it's a unix time
+)
+
+// hasLocks tells if the transaction or any of its inputs waits for something before it can be confirmed
+func (t *Tx) hasLocks() bool {
+	if t.LockTime != 0 {
+		return true
+	}
+	for _, txIn := range t.TxIns {
+		if txIn.LockBlocks != 0 || txIn.LockSeconds != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isFinal tells if the lock time of the transaction has passed for a block at height,
+// medianTime is the median time past of the block before it. a time is checked against the median time, not a block timestamp,
+// so a miner can't unlock a transaction early by putting a timestamp in the future
+func (t *Tx) isFinal(height, medianTime int) bool {
+	if t.LockTime == 0 {
+		return true
+	}
+	if t.LockTime < lockTimeThreshold {
+		return height >= t.LockTime
+	}
+	return medianTime >= t.LockTime
+}
+
+// relativeLockPassed tells if the output spent by txIn has been confirmed long enough for a block at height.
+// the seconds are counted from the median time past of the block that confirmed the output
+func (txIn *TxIn) relativeLockPassed(prev *unspentOutput, height, medianTime int) bool {
+	if txIn.LockBlocks == 0 && txIn.LockSeconds == 0 {
+		return true
+	}
+	if prev.Height >= height { // not confirmed yet, nothing to count from
+		return false
+	}
+	if height-prev.Height < txIn.LockBlocks {
+		return false
+	}
+	if txIn.LockSeconds == 0 {
+		return true
+	}
+	confirmed, err := FindBlockByHeight(prev.Height)
+	if err != nil {
+		return false
+	}
+	return medianTime-medianTimePast(confirmed) >= txIn.LockSeconds
+}
+
+// nextMedianTime is the median time past the transactions of the next block are checked against
+func nextMedianTime(b *blockchain) int {
+	newest := newestBlock(b)
+	if newest == nil {
+		return 0
+	}
+	return medianTimePast(newest)
+}
+
+// TxLocks are the locks a new transaction is made with, every input gets the same relative locks
+type TxLocks struct {
+	LockTime    int
+	LockBlocks  int
+	LockSeconds int
+}
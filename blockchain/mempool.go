@@ -0,0 +1,377 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	incrementalFeeRate int = 1  // a replacement has to pay at least this much more for every 1000 bytes of itself
+	maxReplacements    int = 25 // a replacement can't push out more transactions than this, descendants included
+	maxAncestors       int = 25 // a transaction and its unconfirmed parents (and theirs) can't be more than this
+)
+
+// MempoolPolicy is how much the mempool of this node holds. unlike the monetary policy it's up to each node,
+// a transaction another node dropped is still valid in a block
+type MempoolPolicy struct {
+	MaxSize int `json:"maxSize"` // the transactions of the mempool can't be bigger than this many bytes
+	Expiry  int `json:"expiry"`  // transactions that waited this long (in seconds) are dropped
+}
+
+var mempoolPolicy = MempoolPolicy{
+	MaxSize: 1000000,
+	Expiry:  3 * 24 * 60 * 60,
+}
+
+// GetMempoolPolicy returns the size cap and the expiry the mempool is using
+func GetMempoolPolicy() MempoolPolicy {
+	return mempoolPolicy
+}
+
+// SetMempoolPolicy replaces the size cap and the expiry of the mempool,
+// it has to be called before Blockchain() restores the saved mempool
+func SetMempoolPolicy(p MempoolPolicy) error {
+	if p.MaxSize <= 0 || p.Expiry <= 0 {
+		return ErrInvalidMempoolPolicy
+	}
+	mempoolPolicy = p
+	return nil
+}
+
+var (
+	ErrMempoolFull          = errors.New("mempool is full and the transaction's fee rate is too low")
+	ErrReplacementFee       = errors.New("replacement must pay the fees of the transactions it replaces and the incremental fee on top")
+	ErrTooManyReplacements  = errors.New("replacement would push too many transactions out of the mempool")
+	ErrReplacementSpends    = errors.New("replacement can't spend the outputs of the transactions it replaces")
+	ErrTooManyAncestors     = errors.New("transaction has too many unconfirmed parents")
+	ErrTxNonStandard        = errors.New("transaction output script is not one of the standard templates")
+	ErrInvalidMempoolPolicy = errors.New("mempool size and expiry must be positive")
+)
+
+// mempoolEntry is what the mempool knows about a transaction besides the transaction itself
+type mempoolEntry struct {
+	fee   int
+	size  int
+	added int // when the transaction got to us, the expiry counts from it. the timestamp of the tx is set by whoever made it
+}
+
+// mempoolRecord is how a transaction of the mempool is saved, with when it got to us so it keeps its age after a restart
+type mempoolRecord struct {
+	Tx    *Tx
+	Added int
+}
+
+// lookup finds an output a transaction entering the mempool can spend,
+// either a confirmed one or one made by a transaction that is still in the mempool
+func (m *mempool) lookup(txID string, index int) *unspentOutput {
+	if parent, ok := m.Txs[txID]; ok {
+		if index < 0 || index >= len(parent.TxOuts) {
+			return nil
+		}
+		return &unspentOutput{TxID: txID, Index: index, Output: parent.TxOuts[index], Height: b.Height + 1} // confirmed in the next block at the earliest
+	}
+	return getUTxOut(txID, index)
+}
+
+// byID returns the transactions of the mempool sorted by id, so anything going through them does it the same way every time
+func (m *mempool) byID() []*Tx {
+	var txs []*Tx
+	for _, tx := range m.Txs {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].ID < txs[j].ID
+	})
+	return txs
+}
+
+// orderParentsFirst sorts the transactions so every transaction comes after the ones in txs it spends from,
+// that's the order they have to be validated and mined in
+func orderParentsFirst(txs []*Tx) []*Tx {
+	byID := make(map[string]*Tx)
+	for _, tx := range txs {
+		byID[tx.ID] = tx
+	}
+	done := make(map[string]bool)
+	var ordered []*Tx
+	var visit func(tx *Tx)
+	visit = func(tx *Tx) {
+		if done[tx.ID] {
+			return
+		}
+		done[tx.ID] = true
+		for _, txIn := range tx.TxIns {
+			if parent, ok := byID[txIn.TxID]; ok {
+				visit(parent)
+			}
+		}
+		ordered = append(ordered, tx)
+	}
+	for _, tx := range txs {
+		visit(tx)
+	}
+	return ordered
+}
+
+// ancestors returns the transaction and every unconfirmed transaction it spends from (and theirs), parents first.
+// the ones in skip are left out, they are already in the block being made
+func (m *mempool) ancestors(id string, skip map[string]bool) []*Tx {
+	found := make(map[string]bool)
+	var txs []*Tx
+	var visit func(id string)
+	visit = func(id string) {
+		tx, ok := m.Txs[id]
+		if !ok || found[id] || skip[id] {
+			return
+		}
+		found[id] = true
+		for _, txIn := range tx.TxIns {
+			visit(txIn.TxID)
+		}
+		txs = append(txs, tx)
+	}
+	visit(id)
+	return txs
+}
+
+// higherFeeRate tells if fee for size bytes is a higher fee rate than otherFee for otherSize bytes, without rounding
+func higherFeeRate(fee, size, otherFee, otherSize int) bool {
+	return fee*otherSize > otherFee*size
+}
+
+// packageOf sums the fees and sizes of the transactions
+func (m *mempool) packageOf(txs []*Tx) (fee int, size int) {
+	for _, tx := range txs {
+		fee += m.entries[tx.ID].fee
+		size += m.entries[tx.ID].size
+	}
+	return fee, size
+}
+
+// selectTxs picks the transactions for a block of at most maxSize bytes.
+// a transaction is ranked by the fee rate of its package, itself and the unconfirmed parents it needs,
+// so a child paying a high fee gets its parents mined too (child pays for parent). parents always come before their children
+func (m *mempool) selectTxs(maxSize int) ([]*Tx, int) {
+	selected := make(map[string]bool)
+	skipped := make(map[string]bool) // their package doesn't fit anymore
+	var txs []*Tx
+	size, fees := 0, 0
+	for {
+		var best []*Tx
+		bestID, bestFee, bestSize := "", 0, 0
+		smallest := 0
+		for id := range m.Txs {
+			if selected[id] || skipped[id] {
+				continue
+			}
+			pkg := m.ancestors(id, selected)
+			fee, pkgSize := m.packageOf(pkg)
+			if smallest == 0 || pkgSize < smallest {
+				smallest = pkgSize
+			}
+			if best == nil || higherFeeRate(fee, pkgSize, bestFee, bestSize) ||
+				(!higherFeeRate(bestFee, bestSize, fee, pkgSize) && id < bestID) { // ties go by id, so every node picks the same way
+				best, bestID, bestFee, bestSize = pkg, id, fee, pkgSize
+			}
+		}
+		if best == nil || size+smallest > maxSize { // nothing left, or nothing that fits
+			return txs, fees
+		}
+		if size+bestSize > maxSize { // a smaller package with a lower fee rate might still fit
+			skipped[bestID] = true
+			continue
+		}
+		for _, tx := range best {
+			selected[tx.ID] = true
+		}
+		txs = append(txs, best...)
+		size += bestSize
+		fees += bestFee
+	}
+}
+
+// removeWithDescendants removes the transaction and every transaction spending its outputs, they can't be confirmed without it
+func (m *mempool) removeWithDescendants(id string) {
+	set := make(map[string]bool)
+	addDescendants(id, m.children(), set)
+	for id := range set {
+		m.remove(id)
+	}
+}
+
+// trim drops the expired transactions, then the ones with the lowest fee rate until the mempool fits in its max size
+func (m *mempool) trim() {
+	for id := range m.trimmed() {
+		m.remove(id)
+	}
+}
+
+// trimmed returns what trim would drop, without changing the mempool.
+// a transaction is ranked by its own fee rate or, if it's higher, the fee rate with its descendants,
+// so a parent isn't dropped when its children pay for it. descendants always leave with their parent.
+// it runs for every new transaction, so the children are only found once. a transaction can't have more than maxAncestors,
+// so all the descendant sets together have at most maxAncestors times as many transactions as the mempool
+func (m *mempool) trimmed() map[string]bool {
+	children := m.children()
+	dropped := make(map[string]bool)
+	now := int(time.Now().Unix())
+	for id, entry := range m.entries {
+		if now-entry.added > mempoolPolicy.Expiry {
+			addDescendants(id, children, dropped)
+		}
+	}
+	size := 0
+	for id, entry := range m.entries {
+		if !dropped[id] {
+			size += entry.size
+		}
+	}
+	if size <= mempoolPolicy.MaxSize {
+		return dropped
+	}
+	type score struct {
+		id        string
+		fee, size int
+	}
+	var scores []score
+	for id, entry := range m.entries {
+		if dropped[id] {
+			continue
+		}
+		s := score{id, entry.fee, entry.size}
+		descendants := make(map[string]bool)
+		addDescendants(id, children, descendants)
+		var withDescendants []*Tx
+		for descendant := range descendants {
+			if !dropped[descendant] { // it might have expired
+				withDescendants = append(withDescendants, m.Txs[descendant])
+			}
+		}
+		if fee, pkgSize := m.packageOf(withDescendants); higherFeeRate(fee, pkgSize, s.fee, s.size) {
+			s.fee, s.size = fee, pkgSize
+		}
+		scores = append(scores, s)
+	}
+	sort.Slice(scores, func(i, j int) bool { // the lowest first
+		a, b := scores[i], scores[j]
+		if higherFeeRate(b.fee, b.size, a.fee, a.size) {
+			return true
+		}
+		if higherFeeRate(a.fee, a.size, b.fee, b.size) {
+			return false
+		}
+		return a.id > b.id
+	})
+	for _, s := range scores {
+		if size <= mempoolPolicy.MaxSize {
+			break
+		}
+		if dropped[s.id] { // it left with a parent already
+			continue
+		}
+		descendants := make(map[string]bool)
+		addDescendants(s.id, children, descendants)
+		for id := range descendants {
+			if !dropped[id] {
+				dropped[id] = true
+				size -= m.entries[id].size
+			}
+		}
+	}
+	return dropped
+}
+
+// with returns what the mempool would be after replacing the transactions in replaced with tx paying fee,
+// so what trim would do with it can be found before anything is changed
+func (m *mempool) with(tx *Tx, fee int, replaced map[string]bool) *mempool {
+	after := &mempool{
+		Txs:     make(map[string]*Tx),
+		entries: make(map[string]*mempoolEntry),
+	}
+	for id, other := range m.Txs {
+		if !replaced[id] {
+			after.Txs[id], after.entries[id] = other, m.entries[id]
+		}
+	}
+	after.Txs[tx.ID] = tx
+	after.entries[tx.ID] = &mempoolEntry{fee, tx.size(), int(time.Now().Unix())}
+	return after
+}
+
+// replaced returns the transactions the tx would push out of the mempool:
+// the ones spending any of the same outputs, and every transaction spending their outputs
+func (m *mempool) replaced(tx *Tx) map[string]bool {
+	spends := make(map[string]bool)
+	for _, txIn := range tx.TxIns {
+		spends[outpointKey(txIn.TxID, txIn.Index)] = true
+	}
+	replaced := make(map[string]bool)
+	var children map[string][]string
+	for id, other := range m.Txs {
+		for _, txIn := range other.TxIns {
+			if spends[outpointKey(txIn.TxID, txIn.Index)] {
+				if children == nil { // most transactions don't replace anything
+					children = m.children()
+				}
+				addDescendants(id, children, replaced)
+				break
+			}
+		}
+	}
+	return replaced
+}
+
+// children maps every transaction of the mempool to the ones spending its outputs,
+// so the descendants can be followed without going through the whole mempool for each of them
+func (m *mempool) children() map[string][]string {
+	children := make(map[string][]string)
+	for id, tx := range m.Txs {
+		parents := make(map[string]bool) // a child spending two outputs of the same parent is only its child once
+		for _, txIn := range tx.TxIns {
+			if _, ok := m.Txs[txIn.TxID]; ok && !parents[txIn.TxID] {
+				parents[txIn.TxID] = true
+				children[txIn.TxID] = append(children[txIn.TxID], id)
+			}
+		}
+	}
+	return children
+}
+
+// addDescendants adds the transaction, and every transaction that spends its outputs (and theirs), to set
+func addDescendants(id string, children map[string][]string, set map[string]bool) {
+	if set[id] {
+		return
+	}
+	set[id] = true
+	for _, child := range children[id] {
+		addDescendants(child, children, set)
+	}
+}
+
+// replacementFee is the least a transaction of size bytes has to pay to replace the transactions in replaced.
+// the old ones were relayed for their fees, so the new one pays for them and for its own bytes on top,
+// otherwise a transaction could be replaced over and over to flood the network for free
+func (m *mempool) replacementFee(replaced map[string]bool, size int) int {
+	fees := 0
+	for id := range replaced {
+		fees += m.entries[id].fee
+	}
+	return fees + feeForSize(incrementalFeeRate, size)
+}
+
+// checkReplacement tells if the tx paying fee is allowed to push the transactions in replaced out of the mempool
+func (m *mempool) checkReplacement(tx *Tx, fee int, replaced map[string]bool) error {
+	if len(replaced) > maxReplacements {
+		return ErrTooManyReplacements
+	}
+	for _, txIn := range tx.TxIns { // those outputs would be gone once it's in
+		if replaced[txIn.TxID] {
+			return ErrReplacementSpends
+		}
+	}
+	if fee < m.replacementFee(replaced, tx.size()) {
+		return ErrReplacementFee
+	}
+	return nil
+}
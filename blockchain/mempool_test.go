@@ -0,0 +1,124 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+func TestBumpTxReportsEvictedDescendants(t *testing.T) {
+	addBlocks(t, monetaryPolicy.CoinbaseMaturity+1)
+	other := strings.Repeat("cd", 64)
+	parent, err := Mempool().AddTx([]*TxOut{{Address: other, Amount: 1}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := &UTxOut{TxID: parent.ID, Index: 0, Amount: parent.TxOuts[0].Amount} // the change comes before the payments
+	child, err := buildTx(wallet.Wallet().Address, []*UTxOut{change}, []*TxOut{{Address: other, Amount: 1}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Mempool().AddPeerTx(child); err != nil {
+		t.Fatal(err)
+	}
+
+	bumped, evicted, err := Mempool().BumpTx(parent.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("got %v bumping, want nil", err)
+	}
+	if bumped.fee(m.lookup) <= parent.fee(m.lookup) {
+		t.Errorf("got a fee of %d, want more than %d", bumped.fee(m.lookup), parent.fee(m.lookup))
+	}
+	found := false
+	for _, id := range evicted {
+		found = found || id == child.ID
+		if id == parent.ID {
+			t.Errorf("got the bumped transaction %s in the evicted ones", id)
+		}
+	}
+	if !found {
+		t.Errorf("got evicted %v, want it to have the child %s", evicted, child.ID)
+	}
+	if _, ok := Mempool().Txs[child.ID]; ok {
+		t.Errorf("the child %s is still in the mempool", child.ID)
+	}
+	addBlocks(t, 1) // the rest of the tests get a wallet without unconfirmed transactions
+}
+
+func TestBumpTxPayingOurselves(t *testing.T) {
+	addBlocks(t, monetaryPolicy.CoinbaseMaturity+1)
+	from := wallet.Wallet().Address
+	consolidation, err := Mempool().AddTx([]*TxOut{{Address: from, Amount: 1}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := 0
+	for _, txIn := range consolidation.TxIns {
+		inputs += m.lookup(txIn.TxID, txIn.Index).Output.Amount
+	}
+
+	bumped, _, err := Mempool().BumpTx(consolidation.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("got %v bumping a transaction only paying us, want nil", err)
+	}
+	if len(bumped.TxIns) != len(consolidation.TxIns) {
+		t.Errorf("got %d inputs, want the same %d", len(bumped.TxIns), len(consolidation.TxIns))
+	}
+	if len(bumped.TxOuts) != 1 || bumped.TxOuts[0].Address != from {
+		t.Fatalf("got outputs %v, want one paying us", bumped.TxOuts)
+	}
+	if fee := bumped.fee(m.lookup); fee <= consolidation.fee(m.lookup) || bumped.TxOuts[0].Amount != inputs-fee {
+		t.Errorf("got %d back with a fee of %d, want the %d of the inputs minus a fee higher than %d",
+			bumped.TxOuts[0].Amount, fee, inputs, consolidation.fee(m.lookup))
+	}
+	addBlocks(t, 1)
+}
+
+func TestFullMempoolKeepsReplacedTxs(t *testing.T) {
+	addBlocks(t, monetaryPolicy.CoinbaseMaturity+1)
+	from, other := wallet.Wallet().Address, strings.Repeat("cd", 64)
+	old, err := Mempool().AddTx([]*TxOut{{Address: other, Amount: 1}}, 20, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Mempool().AddTx([]*TxOut{{Address: other, Amount: 1}}, 10, 0, TxLocks{}); err != nil {
+		t.Fatal(err)
+	}
+	var uTxOuts []*UTxOut
+	for _, txIn := range old.TxIns {
+		u := m.lookup(txIn.TxID, txIn.Index)
+		uTxOuts = append(uTxOuts, &UTxOut{TxID: u.TxID, Index: u.Index, Amount: u.Output.Amount})
+	}
+	for _, uTxOut := range UTxOutsByAddress(from, Blockchain()) {
+		if uTxOut.TxID != old.ID { // it can't spend what it replaces
+			uTxOuts = append(uTxOuts, uTxOut)
+		}
+	}
+	var payments []*TxOut
+	for i := 0; i < 10; i++ {
+		payments = append(payments, &TxOut{Address: other, Amount: 1})
+	}
+	// it pays more than the old one, but it's so much bigger that it has the lowest fee rate of the mempool
+	replacement, err := buildTx(from, uTxOuts, payments, 35, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := GetMempoolPolicy()
+	defer SetMempoolPolicy(policy)
+	size := 0
+	for _, entry := range Mempool().entries {
+		size += entry.size
+	}
+	if err := SetMempoolPolicy(MempoolPolicy{MaxSize: size, Expiry: policy.Expiry}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Mempool().AddPeerTx(replacement); err != ErrMempoolFull {
+		t.Fatalf("got %v, want %v", err, ErrMempoolFull)
+	}
+	if _, ok := Mempool().Txs[old.ID]; !ok {
+		t.Errorf("the rejected replacement pushed %s out of the mempool", old.ID)
+	}
+	addBlocks(t, 1)
+}
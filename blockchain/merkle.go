@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+// MerkleProof is the branch of hashes that connects a transaction to the merkle root of its block
+// a light client only needs the block header to check it
+type MerkleProof struct {
+	TxID       string   `json:"txId"`
+	BlockHash  string   `json:"blockHash"`
+	MerkleRoot string   `json:"merkleRoot"`
+	Position   int      `json:"position"` // the position of the transaction inside the block
+	Branch     []string `json:"branch"`   // the sibling hashes, from the transaction up to the root
+}
+
+// merkleParent hashes two nodes of the tree together, the nodes are hex strings of 32 bytes
+func merkleParent(left, right string) (string, error) {
+	leftBytes, err := hex.DecodeString(left)
+	if err != nil {
+		return "", err
+	}
+	rightBytes, err := hex.DecodeString(right)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(append(leftBytes, rightBytes...))
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// merkleLevels builds the tree from the leaves up, levels[0] are the leaves and the last level is the root.
+// if a level has an odd number of nodes, the last node is paired with itself.
+// the leaves are always hashed at least once, so a block with only the coinbase doesn't have the coinbase id as its root
+func merkleLevels(leaves []string) ([][]string, error) {
+	level := leaves
+	levels := [][]string{level}
+	for len(levels) == 1 || len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			parent, err := merkleParent(level[i], right)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, parent)
+		}
+		level = next
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// txIDs are the leaves of the merkle root
+func txIDs(txs []*Tx) []string {
+	var ids []string
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+	return ids
+}
+
+// rootOf returns the root of the tree made from the leaves
+// it returns "" if there are no leaves or one is not a hash, which never matches a mined root
+func rootOf(leaves []string) string {
+	if len(leaves) == 0 {
+		return ""
+	}
+	levels, err := merkleLevels(leaves)
+	if err != nil {
+		return ""
+	}
+	return levels[len(levels)-1][0]
+}
+
+// merkleRoot returns the root of the tree made from the transaction ids
+func merkleRoot(txs []*Tx) string {
+	return rootOf(txIDs(txs))
+}
+
+// witnessRoot returns the root of the tree made from the hashes of the transactions with their signatures.
+// the ids leave the signatures out, so without it a block could be sent with other signatures and the same hash
+func witnessRoot(txs []*Tx) string {
+	var hashes []string
+	for _, tx := range txs {
+		hashes = append(hashes, utils.HashBytes(tx.encode(true)))
+	}
+	return rootOf(hashes)
+}
+
+// Verify checks that hashing the transaction id with the branch gives the merkle root
+func (p *MerkleProof) Verify() bool {
+	hash := p.TxID
+	position := p.Position
+	for _, sibling := range p.Branch {
+		var err error
+		if position%2 == 0 { // the node is on the left, the sibling is on the right
+			hash, err = merkleParent(hash, sibling)
+		} else {
+			hash, err = merkleParent(sibling, hash)
+		}
+		if err != nil {
+			return false
+		}
+		position /= 2
+	}
+	return hash == p.MerkleRoot
+}
+
+// TxMerkleProof returns the proof that the confirmed transaction with the id is inside its block
+func TxMerkleProof(b *blockchain, id string) (*MerkleProof, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	location := findTxLocation(id)
+	if location == nil {
+		return nil, ErrTxNotFound
+	}
+	block, err := FindBlock(location.BlockHash)
+	utils.HandleErr(err)
+	levels, err := merkleLevels(txIDs(block.Transactions))
+	utils.HandleErr(err)
+	proof := &MerkleProof{
+		TxID:       id,
+		BlockHash:  block.Hash,
+		MerkleRoot: block.MerkleRoot,
+		Position:   location.Position,
+		Branch:     []string{},
+	}
+	index := location.Position
+	for _, level := range levels[:len(levels)-1] { // every level except the root
+		sibling := index ^ 1 // the other node of the pair
+		if sibling >= len(level) {
+			sibling = index // the last node of an odd level is paired with itself
+		}
+		proof.Branch = append(proof.Branch, level[sibling])
+		index /= 2
+	}
+	return proof, nil
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import "errors"
+
+// MonetaryPolicy is how many coins the network makes. the subsidy of the coinbase starts at InitialSubsidy
+// and halves every HalvingInterval blocks until it's 0, so there will never be more than MaxSupply coins.
+// the coins of a coinbase can only be spent CoinbaseMaturity blocks after it, so a reorg can't leave spends of coins that are gone
+type MonetaryPolicy struct {
+	InitialSubsidy   int `json:"initialSubsidy"`
+	HalvingInterval  int `json:"halvingInterval"`
+	CoinbaseMaturity int `json:"coinbaseMaturity"`
+}
+
+// monetaryPolicy is a network parameter, every node of the network has to use the same one
+var monetaryPolicy = MonetaryPolicy{
+	InitialSubsidy:   50,
+	HalvingInterval:  210, // bitcoin halves every 210000 blocks, we are a lot smaller
+	CoinbaseMaturity: 10,  // bitcoin waits 100 blocks
+}
+
+// maxMoney is more than any policy can make, so a fee times the bytes it pays for (how fee rates are compared) fits in an int
+const maxMoney int = 1 << 42
+
+var ErrInvalidMonetaryPolicy = errors.New("subsidy and halving interval must be positive, coinbase maturity can't be negative and the max supply must be under 2^42")
+
+// SetMonetaryPolicy replaces the schedule of the subsidy, it has to be called before Blockchain() makes or restores the chain.
+// there is no separate cap, the max supply is what the subsidy and the halving interval add up to
+func SetMonetaryPolicy(p MonetaryPolicy) error {
+	// every halving adds half as much as the one before, so the max supply is less than 2 * InitialSubsidy * HalvingInterval
+	if p.InitialSubsidy <= 0 || p.HalvingInterval <= 0 || p.CoinbaseMaturity < 0 || p.InitialSubsidy > maxMoney/2/p.HalvingInterval {
+		return ErrInvalidMonetaryPolicy
+	}
+	monetaryPolicy = p
+	return nil
+}
+
+// Supply is how many coins exist at a height of the blockchain
+type Supply struct {
+	Policy            MonetaryPolicy `json:"policy"`
+	Height            int            `json:"height"`
+	Issued            int            `json:"issued"`
+	Remaining         int            `json:"remaining"`
+	MaxSupply         int            `json:"maxSupply"`
+	NextSubsidy       int            `json:"nextSubsidy"`
+	NextHalvingHeight int            `json:"nextHalvingHeight,omitempty"` // missing once the subsidy is 0
+}
+
+// subsidy is the new coins the coinbase of the block at the height can make
+func (p MonetaryPolicy) subsidy(height int) int {
+	halvings := (height - 1) / p.HalvingInterval // the genesis block is height 1
+	return p.InitialSubsidy >> halvings          // halving is shifting right by 1, once there are no bits left it's 0
+}
+
+// issued is the coins made by the blocks from the genesis block up to the height
+func (p MonetaryPolicy) issued(height int) int {
+	total := 0
+	for start := 1; start <= height; start += p.HalvingInterval { // every block between two halvings has the same subsidy
+		reward := p.subsidy(start)
+		if reward == 0 {
+			break
+		}
+		blocks := p.HalvingInterval
+		if start+blocks-1 > height {
+			blocks = height - start + 1
+		}
+		total += reward * blocks
+	}
+	return total
+}
+
+// maxSupply is the coins that exist once the subsidy is 0
+func (p MonetaryPolicy) maxSupply() int {
+	total := 0
+	for reward := p.InitialSubsidy; reward > 0; reward >>= 1 {
+		total += reward * p.HalvingInterval
+	}
+	return total
+}
+
+// inMoneyRange tells if the amount could exist, a sum is checked after every add so it can't overflow.
+// the max supply is far below the biggest int, so two amounts in range can always be added
+func (p MonetaryPolicy) inMoneyRange(amount int) bool {
+	return amount >= 0 && amount <= p.maxSupply()
+}
+
+// GetSupply returns the coins issued and still to be issued at the newest block
+func GetSupply(b *blockchain) Supply {
+	b.m.Lock()
+	defer b.m.Unlock()
+	p := monetaryPolicy
+	issued := p.issued(b.Height)
+	supply := Supply{
+		Policy:      p,
+		Height:      b.Height,
+		Issued:      issued,
+		Remaining:   p.maxSupply() - issued,
+		MaxSupply:   p.maxSupply(),
+		NextSubsidy: p.subsidy(b.Height + 1),
+	}
+	if supply.NextSubsidy > 0 {
+		supply.NextHalvingHeight = (b.Height/p.HalvingInterval+1)*p.HalvingInterval + 1
+	}
+	return supply
+}
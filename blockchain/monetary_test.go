@@ -0,0 +1,28 @@
+package blockchain
+
+import "testing"
+
+func TestSetMonetaryPolicy(t *testing.T) {
+	original := monetaryPolicy
+	defer func() { monetaryPolicy = original }()
+	tests := []struct {
+		name   string
+		policy MonetaryPolicy
+		err    error
+	}{
+		{"no subsidy", MonetaryPolicy{0, 210, 10}, ErrInvalidMonetaryPolicy},
+		{"no halvings", MonetaryPolicy{50, 0, 10}, ErrInvalidMonetaryPolicy},
+		{"negative maturity", MonetaryPolicy{50, 210, -1}, ErrInvalidMonetaryPolicy},
+		{"max supply too big to add up", MonetaryPolicy{maxMoney / 2, 2, 10}, ErrInvalidMonetaryPolicy},
+		{"halving every 100 blocks", MonetaryPolicy{64, 100, 5}, nil},
+	}
+	for _, test := range tests {
+		if err := SetMonetaryPolicy(test.policy); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+	if monetaryPolicy.subsidy(101) != 32 || monetaryPolicy.maxSupply() != 12700 {
+		t.Errorf("got a subsidy of %d after the first halving and a max supply of %d, want 32 and 12700",
+			monetaryPolicy.subsidy(101), monetaryPolicy.maxSupply())
+	}
+}
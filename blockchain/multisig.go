@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+var (
+	ErrNotMultisig         = errors.New("address has no unspent outputs locked by a multisig script")
+	ErrNotCosigner         = errors.New("our wallet is not one of the keys of any input")
+	ErrNotEnoughSignatures = errors.New("an input doesn't have enough valid signatures yet")
+	ErrInvalidPartialTx    = errors.New("partial transaction doesn't match the outputs it spends")
+)
+
+// PartialTx is a transaction spending multisig outputs that is still collecting the signatures of the cosigners.
+// it goes from the node of one cosigner to the next, each one adding its signatures, until every input has enough
+type PartialTx struct {
+	Tx         *Tx        `json:"tx"`
+	Signatures [][]string `json:"signatures"` // for every input, a signature for every key of its script in the same order, "" until that key signs
+}
+
+// MakeMultisigTx makes a transaction spending the outputs of a multisig address without any signatures,
+// what is left goes back to the address as change
+func (m *mempool) MakeMultisigTx(address string, payments []*TxOut, fee, feeRate int, locks TxLocks) (*PartialTx, error) {
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	uTxOuts, _ := uTxOutsByAddress(address, b)
+	if len(uTxOuts) == 0 {
+		return nil, ErrorNoMoney
+	}
+	// anyone can pay the address with a plain output, which is locked by a key nobody has instead of the script,
+	// so only the outputs with the multisig script are spent. the address is the hash of the script, so they all have the same one
+	var script string
+	var multisigOuts []*UTxOut
+	for _, uTxOut := range uTxOuts {
+		prevScript := m.lookup(uTxOut.TxID, uTxOut.Index).Output.Script
+		if _, _, ok := parseMultisig(prevScript); !ok || (script != "" && prevScript != script) {
+			continue
+		}
+		script = prevScript
+		multisigOuts = append(multisigOuts, uTxOut)
+	}
+	if len(multisigOuts) == 0 {
+		return nil, ErrNotMultisig
+	}
+	required, pubKeys, _ := parseMultisig(script)
+	unlock := strings.TrimSpace(strings.Repeat(strings.Repeat("0", pubKeyLength)+" ", required)) // a signature is as long as a public key
+	tx, err := buildUnsignedTx(&TxOut{Address: address, Script: script}, unlock, multisigOuts, payments, fee, feeRate, locks)
+	if err != nil {
+		return nil, err
+	}
+	p := &PartialTx{Tx: tx}
+	for _, txIn := range tx.TxIns {
+		txIn.Signature = ""
+		p.Signatures = append(p.Signatures, make([]string, len(pubKeys)))
+	}
+	return p, nil
+}
+
+// inputKeys returns the signatures needed and the public keys of every input, after checking that the partial transaction
+// is in one piece and only spends multisig outputs. the caller has to hold the locks of b and the mempool
+func (p *PartialTx) inputKeys() ([]int, [][]string, error) {
+	if err := validateTxID(p.Tx); err != nil {
+		return nil, nil, err
+	}
+	if len(p.Signatures) != len(p.Tx.TxIns) {
+		return nil, nil, ErrInvalidPartialTx
+	}
+	var required []int
+	var keys [][]string
+	for i, txIn := range p.Tx.TxIns {
+		prev := m.lookup(txIn.TxID, txIn.Index)
+		if prev == nil {
+			return nil, nil, ErrTxMissingInput
+		}
+		n, pubKeys, ok := parseMultisig(prev.Output.Script)
+		if !ok || len(p.Signatures[i]) != len(pubKeys) {
+			return nil, nil, ErrInvalidPartialTx
+		}
+		required = append(required, n)
+		keys = append(keys, pubKeys)
+	}
+	return required, keys, nil
+}
+
+// SignPartialTx adds the signature of our wallet to every input that has our key
+func (m *mempool) SignPartialTx(p *PartialTx) error {
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	_, keys, err := p.inputKeys()
+	if err != nil {
+		return err
+	}
+	signed := false
+	for i, pubKeys := range keys {
+		for k, pubKey := range pubKeys {
+			if pubKey == wallet.Wallet().Address {
+				p.Signatures[i][k] = wallet.Sign(p.Tx.sigHash(i), wallet.Wallet())
+				signed = true
+			}
+		}
+	}
+	if !signed {
+		return ErrNotCosigner
+	}
+	return nil
+}
+
+// AddPartialTx puts the signatures into the unlocking scripts once every input has enough of them,
+// and adds the transaction to the mempool like any other
+func (m *mempool) AddPartialTx(p *PartialTx) (*Tx, error) {
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	required, keys, err := p.inputKeys()
+	if err != nil {
+		return nil, err
+	}
+	for i, txIn := range p.Tx.TxIns {
+		var sigs []string
+		for k, sig := range p.Signatures[i] {
+			if len(sigs) < required[i] && wallet.Verify(sig, p.Tx.sigHash(i), keys[i][k]) { // in the order of the keys, like the script checks them
+				sigs = append(sigs, sig)
+			}
+		}
+		if len(sigs) < required[i] {
+			return nil, ErrNotEnoughSignatures
+		}
+		txIn.Signature = strings.Join(sigs, " ")
+	}
+	if err := addToMempool(b, p.Tx); err != nil {
+		return nil, err
+	}
+	return p.Tx, nil
+}
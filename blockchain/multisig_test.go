@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+func TestMakeMultisigTxSkipsPlainOutputs(t *testing.T) {
+	addBlocks(t, monetaryPolicy.CoinbaseMaturity+1)
+	script, err := ScriptTemplate{Type: "multisig", PubKeys: []string{wallet.Wallet().Address, strings.Repeat("ab", 64)}, Required: 1}.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ScriptAddress(script)
+	// the plain output is confirmed and the one with the script is not, so the plain one comes first
+	if _, err := Mempool().AddTx([]*TxOut{{Address: address, Amount: 1}}, 1, 0, TxLocks{}); err != nil {
+		t.Fatal(err)
+	}
+	addBlocks(t, 1)
+	funding, err := Mempool().AddTx([]*TxOut{{Address: address, Amount: 10, Script: script}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Mempool().MakeMultisigTx(address, []*TxOut{{Address: wallet.Wallet().Address, Amount: 5}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatalf("got %v making the spend, want nil", err)
+	}
+	for _, txIn := range p.Tx.TxIns {
+		if txIn.TxID != funding.ID {
+			t.Errorf("the spend has an input from %s, want only outputs of %s", txIn.TxID, funding.ID)
+		}
+	}
+	if err := Mempool().SignPartialTx(p); err != nil {
+		t.Fatalf("got %v signing, want nil", err)
+	}
+	if _, err := Mempool().AddPartialTx(p); err != nil {
+		t.Fatalf("got %v broadcasting, want nil", err)
+	}
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/jeyoungjung/zerocoin/db"
+)
+
+var (
+	ErrInvalidDocumentHash = errors.New("document hash must be 32 bytes of lowercase hex")
+	ErrNotNotarized        = errors.New("no transaction carries this document hash")
+)
+
+// Notarization is the proof that a document hash was put on the chain no later than the block that confirmed it
+type Notarization struct {
+	Hash          string       `json:"hash"`
+	TxID          string       `json:"txId"`
+	BlockHash     string       `json:"blockHash,omitempty"`
+	BlockHeight   int          `json:"blockHeight,omitempty"`
+	Timestamp     int          `json:"timestamp,omitempty"`  // the timestamp of the block
+	MedianTime    int          `json:"medianTime,omitempty"` // the median time past of the block, it can't be moved by a single miner
+	Confirmations int          `json:"confirmations"`
+	InMempool     bool         `json:"inMempool"`
+	Proof         *MerkleProof `json:"proof,omitempty"` // connects the transaction to the block header
+}
+
+// Notarize puts the document hash on the chain in a data output of a transaction from our wallet
+func (m *mempool) Notarize(hash string, fee, feeRate int) (*Tx, error) {
+	if !isHash(hash) {
+		return nil, ErrInvalidDocumentHash
+	}
+	return m.AddTx([]*TxOut{{Script: dataScript(hash)}}, fee, feeRate, TxLocks{})
+}
+
+// FindNotarization returns the earliest confirmed transaction carrying the document hash with the proof of its block,
+// or the transaction of the mempool carrying it if none is confirmed yet
+func FindNotarization(b *blockchain, hash string) (*Notarization, error) {
+	var earliest *TxStatus
+	for _, id := range db.GetTxsByData(hash) {
+		status, err := FindTxStatus(b, id)
+		if err != nil || status.InMempool { // disconnected since we looked it up
+			continue
+		}
+		if earliest == nil || status.BlockHeight < earliest.BlockHeight {
+			earliest = status
+		}
+	}
+	if earliest == nil {
+		if tx := Mempool().dataCarrier(hash); tx != nil {
+			return &Notarization{Hash: hash, TxID: tx.ID, InMempool: true}, nil
+		}
+		return nil, ErrNotNotarized
+	}
+	proof, err := TxMerkleProof(b, earliest.Tx.ID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := FindBlock(earliest.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	return &Notarization{
+		Hash:          hash,
+		TxID:          earliest.Tx.ID,
+		BlockHash:     block.Hash,
+		BlockHeight:   block.Height,
+		Timestamp:     block.Timestamp,
+		MedianTime:    medianTimePast(block),
+		Confirmations: earliest.Confirmations,
+		Proof:         proof,
+	}, nil
+}
+
+// dataCarrier returns a transaction of the mempool with a data output carrying data, or nil
+func (m *mempool) dataCarrier(data string) *Tx {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, tx := range m.Txs {
+		for _, txOut := range tx.TxOuts {
+			if carried, ok := txOut.data(); ok && carried == data {
+				return tx
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/jeyoungjung/zerocoin/db"
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+// chainWork returns the total work of the chain ending at the block with the hash
+// blocks saved before the work was stored get their work calculated and saved the first time they're asked for
+func chainWork(hash string) *big.Int {
+	if hash == "" { // before the genesis block, there is no work
+		return big.NewInt(0)
+	}
+	if data := db.GetChainWork(hash); data != nil {
+		return new(big.Int).SetBytes(data)
+	}
+	block, err := FindBlock(hash)
+	utils.HandleErr(err)
+	work := new(big.Int).Add(chainWork(block.PrevHash), consensus.Work(block))
+	db.SaveChainWork(hash, work.Bytes())
+	return work
+}
+
+// parentOf returns the previous block, or nil for the genesis block.
+// it's reachable from blocks of peers, so a missing parent is an error and not a panic
+func parentOf(block *Block) (*Block, error) {
+	if block.PrevHash == "" {
+		return nil, nil
+	}
+	parent, err := FindBlock(block.PrevHash)
+	if err != nil {
+		return nil, ErrOrphanBlock
+	}
+	return parent, nil
+}
+
+// acceptBlock checks everything that can be checked without the unspent outputs,
+// then stores the block and the total work of its chain. the block might end up on a side branch
+func acceptBlock(newBlock *Block) error {
+	if newBlock == nil {
+		return ErrEmptyBlock
+	}
+	if db.GetBlockData(newBlock.Hash) != nil {
+		return ErrBlockKnown
+	}
+	var parent *Block
+	if newBlock.PrevHash != "" {
+		block, err := FindBlock(newBlock.PrevHash)
+		if err != nil { // we can't check a block without knowing the blocks before it.
+			// blocks are only stored after their parent and never deleted, so a stored parent has every block before it
+			return ErrOrphanBlock
+		}
+		parent = block
+	}
+	if db.IsInvalidBlock(newBlock.PrevHash) { // nothing built on an invalid block can be valid
+		return ErrInvalidBranch
+	}
+	if err := validateBlockHeader(newBlock, parent); err != nil {
+		return err
+	}
+	if err := validateMerkleRoot(newBlock); err != nil {
+		return err
+	}
+	if err := validateBlockSize(newBlock); err != nil {
+		return err
+	}
+	if err := validateCoinbase(newBlock); err != nil {
+		return err
+	}
+	persistBlock(newBlock)
+	db.SaveChainWork(newBlock.Hash, new(big.Int).Add(chainWork(newBlock.PrevHash), consensus.Work(newBlock)).Bytes())
+	return nil
+}
+
+// findFork walks back from the newest block and the new tip until they meet.
+// it returns the hash of the block both chains share ("" if not even the genesis block is shared)
+// and the blocks of the new branch after that block, from the oldest to the newest
+func findFork(b *blockchain, newTip *Block) (string, []*Block, error) {
+	var branch []*Block
+	var err error
+	oldCursor, newCursor := newestBlock(b), newTip
+	for newCursor != nil && (oldCursor == nil || newCursor.Height > oldCursor.Height) {
+		branch = append([]*Block{newCursor}, branch...)
+		if newCursor, err = parentOf(newCursor); err != nil {
+			return "", nil, err
+		}
+	}
+	for oldCursor != nil && (newCursor == nil || oldCursor.Height > newCursor.Height) {
+		oldCursor = mainParentOf(oldCursor)
+	}
+	for oldCursor != nil && newCursor != nil && oldCursor.Hash != newCursor.Hash { // same height now, step back together
+		branch = append([]*Block{newCursor}, branch...)
+		oldCursor = mainParentOf(oldCursor)
+		if newCursor, err = parentOf(newCursor); err != nil {
+			return "", nil, err
+		}
+	}
+	if newCursor == nil {
+		return "", branch, nil
+	}
+	return newCursor.Hash, branch, nil
+}
+
+// mainParentOf returns the parent of a block of our own chain, which always has every block
+func mainParentOf(block *Block) *Block {
+	parent, err := parentOf(block)
+	utils.HandleErr(err)
+	return parent
+}
+
+// markInvalid remembers that the blocks can never be connected. they stay stored, so blocks built on them
+// can still find their parents, but nothing new is accepted on top of them and their branch is never tried again
+func markInvalid(blocks []*Block) {
+	var hashes []string
+	for _, block := range blocks {
+		hashes = append(hashes, block.Hash)
+	}
+	db.SaveInvalidBlocks(hashes)
+}
+
+// reorganize disconnects blocks back to where the new tip's branch splits off, then connects the branch.
+// if a block of the branch has invalid transactions, it and the blocks after it are marked as invalid,
+// and we go back to the old chain unless the valid part of the branch still has more work.
+// the caller has to hold the locks of b and the mempool
+func reorganize(b *blockchain, newTip *Block) error {
+	oldWork := chainWork(b.NewestHash)
+	forkHash, branch, err := findFork(b, newTip)
+	if err != nil {
+		return err
+	}
+	for i, block := range branch { // it was stored before one of its parents failed, so nothing was checked against it yet
+		if db.IsInvalidBlock(block.Hash) {
+			markInvalid(branch[i:])
+			return ErrInvalidBranch
+		}
+	}
+	var disconnected []*Block
+	for b.NewestHash != forkHash {
+		disconnected = append(disconnected, disconnectBlock(b))
+	}
+	for i, block := range branch {
+		if err := connectBlock(b, block); err != nil {
+			markInvalid(branch[i:])
+			if chainWork(b.NewestHash).Cmp(oldWork) < 0 {
+				for b.NewestHash != forkHash {
+					disconnectBlock(b)
+				}
+				for j := len(disconnected) - 1; j >= 0; j-- { // disconnected goes from the newest to the oldest block
+					utils.HandleErr(connectBlock(b, disconnected[j]))
+				}
+			}
+			revalidateMempool(b)
+			return err
+		}
+	}
+	revalidateMempool(b)
+	return nil
+}
+
+// connectBlock makes the block the newest block of b. its parent has to be the current newest block
+func connectBlock(b *blockchain, block *Block) error {
+	if err := validateBlockTxs(block); err != nil {
+		return err
+	}
+	db.SaveBlockHeight(block.Height, block.Hash)
+	indexTxs(block)
+	connectUTxOs(block)
+	b.NewestHash = block.Hash // newesthash, height and currentbits is updated every time a block is connected
+	b.Height = block.Height
+	b.CurrentBits = block.Bits
+
+	spent := make(map[string]bool)
+	for _, tx := range block.Transactions { // if the transaction inside the current mempool is resolved by the
+		// new block, delete the transaction from the current mempool
+		m.remove(tx.ID)
+		for _, txIn := range tx.TxIns {
+			spent[outpointKey(txIn.TxID, txIn.Index)] = true
+		}
+	}
+	for id, tx := range m.Txs { // transactions spending the same money as the new block can never be confirmed anymore
+		for _, txIn := range tx.TxIns {
+			if spent[outpointKey(txIn.TxID, txIn.Index)] {
+				m.removeWithDescendants(id)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// disconnectBlock removes the newest block from b and puts its transactions back into the mempool
+func disconnectBlock(b *blockchain) *Block {
+	block := newestBlock(b)
+	parent := mainParentOf(block)
+	db.DeleteBlockHeight(block.Height)
+	unindexTxs(block)
+	disconnectUTxOs(block)
+	b.NewestHash = block.PrevHash
+	b.Height = block.Height - 1
+	b.CurrentBits = 0
+	if parent != nil {
+		b.CurrentBits = parent.Bits
+	}
+	for _, tx := range block.Transactions {
+		if !tx.isCoinbase() { // the coinbase belongs to the block, it can't be confirmed by another block
+			m.add(tx, 0) // the fee is set by revalidateMempool, once every block is disconnected
+		}
+	}
+	return block
+}
+
+// revalidateMempool drops the transactions that are not valid anymore after the blockchain changed.
+// parents are checked first, so the children of a dropped transaction are dropped too
+func revalidateMempool(b *blockchain) {
+	spent := make(map[string]bool)
+	for _, tx := range orderParentsFirst(m.byID()) {
+		fee, err := validateTx(tx, m.lookup, b.Height+1, nextMedianTime(b))
+		for _, txIn := range tx.TxIns { // transactions of disconnected blocks can spend the same money as ones that were in the mempool
+			if spent[outpointKey(txIn.TxID, txIn.Index)] {
+				err = ErrTxDoubleSpend
+			}
+		}
+		if err != nil {
+			m.remove(tx.ID)
+			continue
+		}
+		for _, txIn := range tx.TxIns {
+			spent[outpointKey(txIn.TxID, txIn.Index)] = true
+		}
+		m.entries[tx.ID].fee = fee
+	}
+	m.trim() // transactions of disconnected blocks came back, so it might be too big now
+}
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+// blockOn mines a block on top of parent paying miner the subsidy and fees, and gives it to the blockchain like a peer would
+func blockOn(t *testing.T, parent *Block, miner string, fees int, txs ...*Tx) *Block {
+	t.Helper()
+	bits, err := consensus.NextBits(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &Block{
+		Version:      blockVersion,
+		PrevHash:     parent.Hash,
+		Height:       parent.Height + 1,
+		Bits:         bits,
+		Transactions: append([]*Tx{makeCoinbaseTx(miner, parent.Height+1, fees)}, txs...),
+	}
+	block.MerkleRoot = merkleRoot(block.Transactions)
+	block.WitnessRoot = witnessRoot(block.Transactions)
+	if err := consensus.Seal(block, medianTimePast(parent)+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := Blockchain().AddPeerBlock(block); err != nil {
+		t.Fatalf("adding block %d: %v", block.Height, err)
+	}
+	return block
+}
+
+func newestBlockOf(t *testing.T) *Block {
+	t.Helper()
+	block, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+type outpoint struct {
+	txID  string
+	index int
+}
+
+// checkUnspent checks which outputs are in the utxo set
+func checkUnspent(t *testing.T, when string, want map[outpoint]bool) {
+	t.Helper()
+	for out, unspent := range want {
+		if got := getUTxOut(out.txID, out.index) != nil; got != unspent {
+			t.Errorf("%s: got %v for %s being unspent, want %v", when, got, outpointKey(out.txID, out.index), unspent)
+		}
+	}
+}
+
+// checkMempool checks which transactions are in the mempool
+func checkMempool(t *testing.T, when string, want map[string]bool) {
+	t.Helper()
+	for id, in := range want {
+		if _, got := Mempool().Txs[id]; got != in {
+			t.Errorf("%s: got %v for %s being in the mempool, want %v", when, got, id, in)
+		}
+	}
+}
+
+func TestReorganizeBetweenTwoBranches(t *testing.T) {
+	addBlocks(t, monetaryPolicy.CoinbaseMaturity+1)
+	from, other := wallet.Wallet().Address, strings.Repeat("ef", 64)
+	minerA, minerB := strings.Repeat("a1", 64), strings.Repeat("b1", 64)
+	fork := newestBlockOf(t)
+
+	kept, err := Mempool().AddTx([]*TxOut{{Address: other, Amount: 5}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicted, err := Mempool().AddTx([]*TxOut{{Address: other, Amount: 6}}, 1, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptIn := outpoint{kept.TxIns[0].TxID, kept.TxIns[0].Index}
+	conflictedIn := outpoint{conflicted.TxIns[0].TxID, conflicted.TxIns[0].Index}
+	spent := getUTxOut(conflictedIn.txID, conflictedIn.index)
+	if spent == nil {
+		t.Fatalf("%s doesn't spend a confirmed output", conflicted.ID)
+	}
+	// branch b spends what conflicted spends
+	doubleSpend, err := buildTx(from, []*UTxOut{{TxID: conflictedIn.txID, Index: conflictedIn.index, Amount: spent.Output.Amount}},
+		[]*TxOut{{Address: other, Amount: 7}}, 2, 0, TxLocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addBlocks(t, 1) // branch a confirms both
+	a1 := newestBlockOf(t)
+	if len(a1.Transactions) != 3 {
+		t.Fatalf("got %d transactions in the block, want the coinbase and the 2 from the mempool", len(a1.Transactions))
+	}
+	b1 := blockOn(t, fork, minerB, 2, doubleSpend)
+	if Blockchain().NewestHash != a1.Hash {
+		t.Fatal("a branch with the same work replaced the blockchain")
+	}
+	b2 := blockOn(t, b1, minerB, 0)
+	if b := Blockchain(); b.NewestHash != b2.Hash || b.Height != b2.Height {
+		t.Fatalf("got %s at %d after branch b got longer, want %s at %d", b.NewestHash, b.Height, b2.Hash, b2.Height)
+	}
+	if block, _ := FindBlockByHeight(fork.Height + 1); block == nil || block.Hash != b1.Hash {
+		t.Errorf("the height index still points to branch a")
+	}
+	checkUnspent(t, "on branch b", map[outpoint]bool{
+		{b1.Transactions[0].ID, 0}: true,
+		{doubleSpend.ID, 0}:        true,
+		{a1.Transactions[0].ID, 0}: false,
+		{kept.ID, 0}:               false,
+		{conflicted.ID, 0}:         false,
+		keptIn:                     true,
+		conflictedIn:               false,
+	})
+	// kept goes back to the mempool, conflicted can't since branch b spent its input
+	checkMempool(t, "on branch b", map[string]bool{kept.ID: true, conflicted.ID: false, doubleSpend.ID: false})
+	if FindTx(Blockchain(), kept.ID) != nil {
+		t.Errorf("%s is still found as confirmed", kept.ID)
+	}
+
+	a2 := blockOn(t, a1, minerA, 0)
+	a3 := blockOn(t, a2, minerA, 0)
+	if Blockchain().NewestHash != a3.Hash {
+		t.Fatalf("got %s after branch a got longer again, want %s", Blockchain().NewestHash, a3.Hash)
+	}
+	checkUnspent(t, "back on branch a", map[outpoint]bool{
+		{a1.Transactions[0].ID, 0}: true,
+		{kept.ID, 0}:               true,
+		{conflicted.ID, 0}:         true,
+		{b1.Transactions[0].ID, 0}: false,
+		{doubleSpend.ID, 0}:        false,
+		keptIn:                     false,
+		conflictedIn:               false,
+	})
+	// the double spend conflicts with conflicted, which branch a confirmed again
+	checkMempool(t, "back on branch a", map[string]bool{kept.ID: false, conflicted.ID: false, doubleSpend.ID: false})
+	if FindTx(Blockchain(), kept.ID) == nil {
+		t.Errorf("%s is not found as confirmed", kept.ID)
+	}
+	addBlocks(t, 1)
+}
@@ -0,0 +1,587 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jeyoungjung/zerocoin/utils"
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+// a script is a list of tokens separated by single spaces. a token starting with "OP_" is an opcode,
+// anything else is data in lowercase hex that gets pushed on the stack.
+// an output is locked by a script, and the input spending it has to give an unlocking script (in its signature field):
+// the unlocking script runs first, then the locking script runs on the same stack and has to leave true on top.
+// the layout and every opcode are written down in docs/scripts.md
+const (
+	maxScriptSize   int = 10000 // a script can't be longer than this many characters
+	maxStackSize    int = 100   // a script can't have more than this many items on the stack
+	maxMultisigKeys int = 16    // OP_16 is the biggest number a script can push without data
+	pubKeyLength    int = 128   // hex characters of a public key, which is also a plain address
+	maxDataSize     int = 80    // bytes a data output can carry
+)
+
+const (
+	opDup            = "OP_DUP"
+	opDrop           = "OP_DROP"
+	opEqual          = "OP_EQUAL"
+	opEqualVerify    = "OP_EQUALVERIFY"
+	opVerify         = "OP_VERIFY"
+	opHash256        = "OP_HASH256"
+	opCheckSig       = "OP_CHECKSIG"
+	opCheckSigVerify = "OP_CHECKSIGVERIFY"
+	opCheckMultisig  = "OP_CHECKMULTISIG"
+	opReturn         = "OP_RETURN"
+	opIf             = "OP_IF"
+	opElse           = "OP_ELSE"
+	opEndIf          = "OP_ENDIF"
+	opCheckLockTime  = "OP_CHECKLOCKTIMEVERIFY"
+	opPrefix         = "OP_" // OP_0 to OP_16 push that number
+)
+
+var (
+	ErrScriptInvalid    = errors.New("script can't be parsed")
+	ErrScriptFailed     = errors.New("script failed")
+	ErrScriptUnlockPush = errors.New("unlocking script can only push data")
+	ErrUnknownTemplate  = errors.New("script type must be pubKeyHash, multisig, hashLock or htlc")
+	ErrInvalidTemplate  = errors.New("script needs valid public keys, a hash of 32 bytes, a positive timeout and at least 1 required signature but not more than the keys")
+)
+
+// ScriptTemplate describes one of the standard locking scripts, only the fields its Type uses are needed
+type ScriptTemplate struct {
+	Type     string   `json:"type"`     // "pubKeyHash", "multisig", "hashLock" or "htlc"
+	PubKeys  []string `json:"pubKeys"`  // one key, the keys of a multisig, or the recipient and then the sender of an htlc
+	Required int      `json:"required"` // the signatures a multisig needs
+	Hash     string   `json:"hash"`     // the hash the data unlocking a hashLock or an htlc has to have
+	Timeout  int      `json:"timeout"`  // the lock time from which the sender of an htlc can take it back
+}
+
+// Script makes the locking script of the template, outputs can pay it by putting it in their script
+func (t ScriptTemplate) Script() (string, error) {
+	for _, pubKey := range t.PubKeys {
+		if len(pubKey) != pubKeyLength || decodeHex(pubKey) == nil || pubKey != strings.ToLower(pubKey) {
+			return "", ErrInvalidTemplate
+		}
+	}
+	var script string
+	switch t.Type {
+	case "pubKeyHash":
+		if len(t.PubKeys) != 1 {
+			return "", ErrInvalidTemplate
+		}
+		script = payToPubKeyHashScript(t.PubKeys[0])
+	case "multisig":
+		if len(t.PubKeys) == 0 || len(t.PubKeys) > maxMultisigKeys || t.Required < 1 || t.Required > len(t.PubKeys) {
+			return "", ErrInvalidTemplate
+		}
+		script = multisigScript(t.Required, t.PubKeys)
+	case "hashLock":
+		if len(t.PubKeys) != 1 || !isHash(t.Hash) {
+			return "", ErrInvalidTemplate
+		}
+		script = hashLockScript(t.Hash, t.PubKeys[0])
+	case "htlc":
+		if len(t.PubKeys) != 2 || !isHash(t.Hash) || t.Timeout <= 0 {
+			return "", ErrInvalidTemplate
+		}
+		script = htlcScript(t.Hash, t.PubKeys[0], t.PubKeys[1], t.Timeout)
+	default:
+		return "", ErrUnknownTemplate
+	}
+	return script, nil
+}
+
+// ScriptAddress is the address of an output locked by a script, the hash of the script,
+// so the outputs of a script can be found the same way as the outputs of a public key
+func ScriptAddress(script string) string {
+	return utils.HashBytes([]byte(script))
+}
+
+// lockingScript is the script the output is locked with. an output paying a plain address (a public key)
+// is locked by the signature of that key
+func (t *TxOut) lockingScript() string {
+	if t.Script != "" {
+		return t.Script
+	}
+	return payToPubKeyScript(t.Address)
+}
+
+// isData tells if the output only carries data. its script starts with OP_RETURN, so it can never be spent
+// and it's left out of the unspent outputs
+func (t *TxOut) isData() bool {
+	return t.Script == opReturn || strings.HasPrefix(t.Script, opReturn+" ")
+}
+
+// data returns the data carried by a data output as lowercase hex, ok is false if it's not a data output
+// or its script is not OP_RETURN followed by at most maxDataSize bytes
+func (t *TxOut) data() (string, bool) {
+	if !t.isData() {
+		return "", false
+	}
+	tokens, err := parseScript(t.Script)
+	if err != nil || len(tokens) > 2 {
+		return "", false
+	}
+	if len(tokens) == 1 {
+		return "", true
+	}
+	if tokens[1].op != "" || len(tokens[1].data) > maxDataSize {
+		return "", false
+	}
+	return hex.EncodeToString(tokens[1].data), true
+}
+
+// dataScript makes the script of a data output carrying data, in lowercase hex
+func dataScript(data string) string {
+	return fmt.Sprintf("%s %s", opReturn, data)
+}
+
+// payToPubKeyScript locks an output to a public key, the unlocking script is just a signature
+func payToPubKeyScript(pubKey string) string {
+	return fmt.Sprintf("%s %s", pubKey, opCheckSig)
+}
+
+// payToPubKeyHashScript locks an output to the hash of a public key, so the key is only shown once it's spent.
+// the unlocking script is the signature and then the public key
+func payToPubKeyHashScript(pubKey string) string {
+	return fmt.Sprintf("%s %s %s %s %s", opDup, opHash256, utils.HashBytes(decodeHex(pubKey)), opEqualVerify, opCheckSig)
+}
+
+// multisigScript locks an output to required signatures of the public keys.
+// the unlocking script is the signatures in the same order as their keys
+func multisigScript(required int, pubKeys []string) string {
+	return fmt.Sprintf("%s %s %s %s", numberOp(required), strings.Join(pubKeys, " "), numberOp(len(pubKeys)), opCheckMultisig)
+}
+
+// hashLockScript locks an output to whoever knows the data hashing to hash and has the key of pubKey.
+// the unlocking script is the signature and then the data
+func hashLockScript(hash, pubKey string) string {
+	return fmt.Sprintf("%s %s %s %s %s", opHash256, hash, opEqualVerify, pubKey, opCheckSig)
+}
+
+// htlcScript is a hash time-locked contract: the recipient can take the output with the data hashing to hash,
+// or the sender can take it back once the lock time reaches timeout (a block height or a unix time, like Tx.LockTime).
+// the recipient unlocks it with the signature, the data and OP_1, the sender with the signature and OP_0
+func htlcScript(hash, recipient, sender string, timeout int) string {
+	return fmt.Sprintf("%s %s %s %s %s %s %s %s %s %s %s %s %s",
+		opIf, opHash256, hash, opEqualVerify, recipient, opCheckSig,
+		opElse, numberToken(timeout), opCheckLockTime, opDrop, sender, opCheckSig,
+		opEndIf)
+}
+
+// parseHTLC reads the parts of an htlc script
+func parseHTLC(script string) (hash, recipient, sender string, timeout int, ok bool) {
+	tokens, err := parseScript(script)
+	if err != nil || len(tokens) != 13 {
+		return "", "", "", 0, false
+	}
+	ops := []string{opIf, opHash256, "", opEqualVerify, "", opCheckSig, opElse, "", opCheckLockTime, opDrop, "", opCheckSig, opEndIf}
+	for i, op := range ops {
+		if tokens[i].op != op && !(i == 7 && op == "") { // the timeout can be a number opcode
+			return "", "", "", 0, false
+		}
+	}
+	timeout, ok = tokenNumber(tokens[7])
+	if !ok {
+		return "", "", "", 0, false
+	}
+	return hex.EncodeToString(tokens[2].data), hex.EncodeToString(tokens[4].data), hex.EncodeToString(tokens[10].data), timeout, true
+}
+
+func numberOp(n int) string {
+	return fmt.Sprintf("%s%d", opPrefix, n)
+}
+
+// numberToken writes a number the only way a script can have it, with its opcode up to 16 or as big endian data without leading zeros
+func numberToken(n int) string {
+	if n <= maxMultisigKeys {
+		return numberOp(n)
+	}
+	var data []byte
+	for ; n > 0; n >>= 8 {
+		data = append([]byte{byte(n)}, data...)
+	}
+	return hex.EncodeToString(data)
+}
+
+// tokenNumber reads a number written by numberToken
+func tokenNumber(token scriptToken) (int, bool) {
+	if token.op != "" {
+		return smallNumber(token.op)
+	}
+	return scriptNumber(token.data)
+}
+
+// scriptNumber reads an item of the stack as a big endian number, at most 8 bytes and not negative
+func scriptNumber(item []byte) (int, bool) {
+	if len(item) > 8 || (len(item) == 8 && item[0]&0x80 != 0) {
+		return 0, false
+	}
+	n := 0
+	for _, b := range item {
+		n = n<<8 | int(b)
+	}
+	return n, true
+}
+
+func isHash(s string) bool {
+	return len(s) == 64 && decodeHex(s) != nil && s == strings.ToLower(s)
+}
+
+// decodeHex returns nil if the string is not hex, which never hashes to what a script expects
+func decodeHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// scriptToken is an opcode, or the data to push if op is empty
+type scriptToken struct {
+	op   string
+	data []byte
+}
+
+// parseScript splits the script into tokens. there is only one way to write a script,
+// data has to be lowercase hex and the numbers up to 16 have to be pushed with their opcodes
+func parseScript(script string) ([]scriptToken, error) {
+	if script == "" || len(script) > maxScriptSize {
+		return nil, ErrScriptInvalid
+	}
+	var tokens []scriptToken
+	for _, word := range strings.Split(script, " ") {
+		if strings.HasPrefix(word, opPrefix) {
+			if !isOpcode(word) {
+				return nil, ErrScriptInvalid
+			}
+			tokens = append(tokens, scriptToken{op: word})
+			continue
+		}
+		data, err := hex.DecodeString(word)
+		if err != nil || word == "" || word != strings.ToLower(word) {
+			return nil, ErrScriptInvalid
+		}
+		if len(data) == 1 && data[0] <= byte(maxMultisigKeys) {
+			return nil, ErrScriptInvalid
+		}
+		tokens = append(tokens, scriptToken{data: data})
+	}
+	return tokens, nil
+}
+
+func isOpcode(word string) bool {
+	switch word {
+	case opDup, opDrop, opEqual, opEqualVerify, opVerify, opHash256, opCheckSig, opCheckSigVerify, opCheckMultisig, opReturn,
+		opIf, opElse, opEndIf, opCheckLockTime:
+		return true
+	}
+	_, ok := smallNumber(word)
+	return ok
+}
+
+// smallNumber reads OP_0 to OP_16
+func smallNumber(word string) (int, bool) {
+	for n := 0; n <= maxMultisigKeys; n++ {
+		if word == numberOp(n) {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// scriptStack is the stack both scripts of an input run on
+type scriptStack [][]byte
+
+func (s *scriptStack) push(item []byte) error {
+	if len(*s) >= maxStackSize {
+		return ErrScriptFailed
+	}
+	*s = append(*s, item)
+	return nil
+}
+
+func (s *scriptStack) pop() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrScriptFailed
+	}
+	item := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return item, nil
+}
+
+// popNumber pops a number pushed by OP_0 to OP_16
+func (s *scriptStack) popNumber() (int, error) {
+	item, err := s.pop()
+	if err != nil {
+		return 0, err
+	}
+	if len(item) > 1 || (len(item) == 1 && item[0] > byte(maxMultisigKeys)) {
+		return 0, ErrScriptFailed
+	}
+	if len(item) == 0 {
+		return 0, nil
+	}
+	return int(item[0]), nil
+}
+
+// isTrue is false for nothing and for zeros, anything else is true
+func isTrue(item []byte) bool {
+	for _, b := range item {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func boolItem(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+// checkSig tells if sig is a signature of the input at index of the transaction by pubKey
+func checkSig(sig, pubKey []byte, tx *Tx, index int) bool {
+	return wallet.Verify(hex.EncodeToString(sig), tx.sigHash(index), hex.EncodeToString(pubKey))
+}
+
+// verifyScript runs the unlocking script of the input at index and then the locking script of the output it spends
+func verifyScript(unlock, lock string, tx *Tx, index int) error {
+	unlockTokens, err := parseScript(unlock)
+	if err != nil {
+		return err
+	}
+	for _, token := range unlockTokens { // anything else could change what the locking script sees in ways the signatures don't cover
+		if _, ok := smallNumber(token.op); token.op != "" && !ok {
+			return ErrScriptUnlockPush
+		}
+	}
+	lockTokens, err := parseScript(lock)
+	if err != nil {
+		return err
+	}
+	stack := &scriptStack{}
+	if err := runScript(unlockTokens, stack, tx, index); err != nil {
+		return err
+	}
+	if err := runScript(lockTokens, stack, tx, index); err != nil {
+		return err
+	}
+	top, err := stack.pop()
+	if err != nil || !isTrue(top) {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// runScript runs the tokens on the stack, any error means the script failed.
+// branches has an entry for every OP_IF the script is inside of, and only the tokens inside true branches are run
+func runScript(tokens []scriptToken, stack *scriptStack, tx *Tx, index int) error {
+	var branches []bool
+	for _, token := range tokens {
+		running := true
+		for _, branch := range branches {
+			running = running && branch
+		}
+		switch token.op {
+		case opIf:
+			taken := false
+			if running {
+				top, err := stack.pop()
+				if err != nil {
+					return err
+				}
+				taken = isTrue(top)
+			}
+			branches = append(branches, taken)
+			continue
+		case opElse:
+			if len(branches) == 0 {
+				return ErrScriptFailed
+			}
+			branches[len(branches)-1] = !branches[len(branches)-1]
+			continue
+		case opEndIf:
+			if len(branches) == 0 {
+				return ErrScriptFailed
+			}
+			branches = branches[:len(branches)-1]
+			continue
+		}
+		if !running {
+			continue
+		}
+		if token.op == "" {
+			if err := stack.push(token.data); err != nil {
+				return err
+			}
+			continue
+		}
+		if n, ok := smallNumber(token.op); ok {
+			item := []byte{}
+			if n > 0 {
+				item = []byte{byte(n)}
+			}
+			if err := stack.push(item); err != nil {
+				return err
+			}
+			continue
+		}
+		var err error
+		switch token.op {
+		case opDup:
+			var item []byte
+			if item, err = stack.pop(); err == nil {
+				if err = stack.push(item); err == nil {
+					err = stack.push(item)
+				}
+			}
+		case opDrop:
+			_, err = stack.pop()
+		case opEqual, opEqualVerify:
+			var a, b []byte
+			if a, err = stack.pop(); err == nil {
+				if b, err = stack.pop(); err == nil {
+					err = stack.push(boolItem(bytes.Equal(a, b)))
+				}
+			}
+		case opHash256:
+			var item []byte
+			if item, err = stack.pop(); err == nil {
+				hash := sha256.Sum256(item)
+				err = stack.push(hash[:])
+			}
+		case opCheckSig, opCheckSigVerify:
+			var pubKey, sig []byte
+			if pubKey, err = stack.pop(); err == nil {
+				if sig, err = stack.pop(); err == nil {
+					err = stack.push(boolItem(checkSig(sig, pubKey, tx, index)))
+				}
+			}
+		case opCheckMultisig:
+			err = checkMultisig(stack, tx, index)
+		case opCheckLockTime:
+			err = checkLockTime(stack, tx)
+		case opReturn: // the output can never be spent
+			err = ErrScriptFailed
+		case opVerify: // only checks the top, below
+		}
+		if err != nil {
+			return err
+		}
+		if token.op == opVerify || token.op == opEqualVerify || token.op == opCheckSigVerify {
+			top, err := stack.pop()
+			if err != nil || !isTrue(top) {
+				return ErrScriptFailed
+			}
+		}
+	}
+	if len(branches) > 0 { // an OP_IF without its OP_ENDIF
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// checkLockTime fails unless the lock time of the transaction is at least the number on top of the stack, which stays there.
+// both have to be heights or both times. the transaction can't be confirmed before its lock time, so neither can the input
+func checkLockTime(stack *scriptStack, tx *Tx) error {
+	if len(*stack) == 0 {
+		return ErrScriptFailed
+	}
+	lockTime, ok := scriptNumber((*stack)[len(*stack)-1])
+	if !ok || tx.LockTime < lockTime || (lockTime < lockTimeThreshold) != (tx.LockTime < lockTimeThreshold) {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// checkMultisig pops the number of keys, the keys, the number of signatures needed and the signatures.
+// the signatures have to be in the same order as their keys, so each key is only tried once
+func checkMultisig(stack *scriptStack, tx *Tx, index int) error {
+	keyCount, err := stack.popNumber()
+	if err != nil || keyCount == 0 {
+		return ErrScriptFailed
+	}
+	pubKeys := make([][]byte, keyCount)
+	for i := keyCount - 1; i >= 0; i-- {
+		if pubKeys[i], err = stack.pop(); err != nil {
+			return err
+		}
+	}
+	required, err := stack.popNumber()
+	if err != nil || required == 0 || required > keyCount {
+		return ErrScriptFailed
+	}
+	sigs := make([][]byte, required)
+	for i := required - 1; i >= 0; i-- {
+		if sigs[i], err = stack.pop(); err != nil {
+			return err
+		}
+	}
+	key := 0
+	for _, sig := range sigs {
+		for key < len(pubKeys) && !checkSig(sig, pubKeys[key], tx, index) {
+			key++
+		}
+		if key == len(pubKeys) {
+			return stack.push(boolItem(false))
+		}
+		key++
+	}
+	return stack.push(boolItem(true))
+}
+
+// isStandardScript tells if the locking script is one of the templates above.
+// any script is valid in a block, but the mempool only takes the ones wallets know how to spend
+func isStandardScript(script string) bool {
+	tokens, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	ops := make([]string, len(tokens))
+	for i, token := range tokens {
+		ops[i] = token.op
+		if token.op == "" {
+			ops[i] = "data"
+		}
+	}
+	pattern := strings.Join(ops, " ")
+	switch pattern {
+	case "data " + opCheckSig,
+		fmt.Sprintf("%s %s data %s %s", opDup, opHash256, opEqualVerify, opCheckSig),
+		fmt.Sprintf("%s data %s data %s", opHash256, opEqualVerify, opCheckSig):
+		return true
+	}
+	if _, _, _, _, ok := parseHTLC(script); ok {
+		return true
+	}
+	_, _, ok := parseMultisig(script)
+	return ok
+}
+
+// parseMultisig reads the signatures needed and the public keys of a multisig script: OP_m, n keys, OP_n, OP_CHECKMULTISIG
+func parseMultisig(script string) (int, []string, bool) {
+	tokens, err := parseScript(script)
+	if err != nil || len(tokens) < 4 || tokens[len(tokens)-1].op != opCheckMultisig {
+		return 0, nil, false
+	}
+	required, ok := smallNumber(tokens[0].op)
+	keyCount, ok2 := smallNumber(tokens[len(tokens)-2].op)
+	if !ok || !ok2 || keyCount != len(tokens)-3 || required == 0 || required > keyCount {
+		return 0, nil, false
+	}
+	var pubKeys []string
+	for _, token := range tokens[1 : len(tokens)-2] {
+		if token.op != "" {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, hex.EncodeToString(token.data))
+	}
+	return required, pubKeys, true
+}
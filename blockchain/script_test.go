@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jeyoungjung/zerocoin/utils"
+	"github.com/jeyoungjung/zerocoin/wallet"
+)
+
+// testKey is a key besides the one of the wallet, it signs and makes its address the same way the wallet does
+type testKey struct {
+	key *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{key}
+}
+
+func fixedHex(a, b *big.Int) string {
+	z := make([]byte, 64)
+	a.FillBytes(z[:32])
+	b.FillBytes(z[32:])
+	return fmt.Sprintf("%x", z)
+}
+
+func (k testKey) address() string {
+	return fixedHex(k.key.X, k.key.Y)
+}
+
+func (k testKey) sign(payload string) string {
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, decodeHex(payload))
+	if err != nil {
+		panic(err)
+	}
+	return fixedHex(r, s)
+}
+
+// signWallet signs the input of the transaction with the key of the wallet
+func signWallet(tx *Tx) string {
+	return wallet.Sign(tx.sigHash(0), wallet.Wallet())
+}
+
+func TestVerifyScript(t *testing.T) {
+	other, third := newTestKey(t), newTestKey(t)
+	us := wallet.Wallet().Address
+	preimage := strings.Repeat("5a", 32)
+	hash := utils.HashBytes(decodeHex(preimage))
+	const timeout = 100
+	htlc := htlcScript(hash, us, other.address(), timeout)
+	multisig := multisigScript(2, []string{us, other.address(), third.address()})
+	tests := []struct {
+		name     string
+		lock     string
+		lockTime int
+		unlock   func(tx *Tx) string
+		err      error
+	}{
+		{"pay to public key", payToPubKeyScript(us), 0, signWallet, nil},
+		{"pay to public key signed by another key", payToPubKeyScript(us), 0, func(tx *Tx) string {
+			return other.sign(tx.sigHash(0))
+		}, ErrScriptFailed},
+		{"pay to public key hash", payToPubKeyHashScript(us), 0, func(tx *Tx) string {
+			return signWallet(tx) + " " + us
+		}, nil},
+		{"pay to public key hash with another key", payToPubKeyHashScript(us), 0, func(tx *Tx) string {
+			return other.sign(tx.sigHash(0)) + " " + other.address()
+		}, ErrScriptFailed},
+		{"pay to public key hash signing another input", payToPubKeyHashScript(us), 0, func(tx *Tx) string {
+			return wallet.Sign(tx.sigHash(1), wallet.Wallet()) + " " + us
+		}, ErrScriptFailed},
+		{"2 of 3 multisig", multisig, 0, func(tx *Tx) string {
+			return signWallet(tx) + " " + third.sign(tx.sigHash(0))
+		}, nil},
+		{"2 of 3 multisig with the signatures out of order", multisig, 0, func(tx *Tx) string {
+			return third.sign(tx.sigHash(0)) + " " + signWallet(tx)
+		}, ErrScriptFailed},
+		{"2 of 3 multisig with one signature", multisig, 0, signWallet, ErrScriptFailed},
+		{"2 of 3 multisig with a bad signature", multisig, 0, func(tx *Tx) string {
+			return signWallet(tx) + " " + third.sign(tx.sigHash(1))
+		}, ErrScriptFailed},
+		{"2 of 3 multisig with one signature twice", multisig, 0, func(tx *Tx) string {
+			sig := signWallet(tx)
+			return sig + " " + sig
+		}, ErrScriptFailed},
+		{"htlc redeemed with the preimage", htlc, 0, func(tx *Tx) string {
+			return signWallet(tx) + " " + preimage + " OP_1"
+		}, nil},
+		{"htlc redeemed with the wrong preimage", htlc, 0, func(tx *Tx) string {
+			return signWallet(tx) + " " + strings.Repeat("5b", 32) + " OP_1"
+		}, ErrScriptFailed},
+		{"htlc redeemed by the sender", htlc, 0, func(tx *Tx) string {
+			return other.sign(tx.sigHash(0)) + " " + preimage + " OP_1"
+		}, ErrScriptFailed},
+		{"htlc refunded at the timeout", htlc, timeout, func(tx *Tx) string {
+			return other.sign(tx.sigHash(0)) + " OP_0"
+		}, nil},
+		{"htlc refunded before the timeout", htlc, timeout - 1, func(tx *Tx) string {
+			return other.sign(tx.sigHash(0)) + " OP_0"
+		}, ErrScriptFailed},
+		{"htlc refunded by the recipient", htlc, timeout, func(tx *Tx) string {
+			return signWallet(tx) + " OP_0"
+		}, ErrScriptFailed},
+		{"unlocking script running an opcode", payToPubKeyScript(us), 0, func(tx *Tx) string {
+			return signWallet(tx) + " OP_DUP"
+		}, ErrScriptUnlockPush},
+	}
+	for _, test := range tests {
+		tx := &Tx{
+			Version:  txVersion,
+			LockTime: test.lockTime,
+			TxIns:    []*TxIn{{TxID: "prev", Index: 0}},
+			TxOuts:   []*TxOut{{Address: us, Amount: 1}},
+		}
+		tx.hashId()
+		if err := verifyScript(test.unlock(tx), test.lock, tx, 0); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
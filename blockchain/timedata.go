@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	medianTimeSpan int = 11                     // a block has to be newer than the median timestamp of this many blocks before it
+	maxTimeOffset  int = maxFutureBlockTime / 2 // a peer's clock further off than this is ignored, so peers can't push blocks past the limit
+)
+
+// timeOffsets keeps how far the clock of every connected peer is ahead of ours, in seconds
+type timeOffsets struct {
+	v map[string]int
+	m sync.Mutex
+}
+
+var offsets = timeOffsets{
+	v: make(map[string]int),
+}
+
+// AddTimeSample saves the time a peer said it was, so the network time can be calculated
+func AddTimeSample(peer string, peerTime int) {
+	offsets.m.Lock()
+	defer offsets.m.Unlock()
+	offsets.v[peer] = peerTime - int(time.Now().Unix())
+}
+
+// RemoveTimeSample forgets the time of a peer that disconnected
+func RemoveTimeSample(peer string) {
+	offsets.m.Lock()
+	defer offsets.m.Unlock()
+	delete(offsets.v, peer)
+}
+
+// AdjustedTime is our clock moved by the median offset of the peers (our own offset of 0 is counted too),
+// so one node with a wrong clock doesn't split from the network
+func AdjustedTime() int {
+	offsets.m.Lock()
+	defer offsets.m.Unlock()
+	samples := []int{0}
+	for _, offset := range offsets.v {
+		if offset <= maxTimeOffset && offset >= -maxTimeOffset {
+			samples = append(samples, offset)
+		}
+	}
+	sort.Ints(samples)
+	return int(time.Now().Unix()) + samples[len(samples)/2]
+}
+
+// medianTimePast is the median timestamp of the block and the medianTimeSpan-1 blocks before it.
+// unlike the timestamp of one block, it can only go up, so the next block has to be newer than it
+func medianTimePast(block *Block) int {
+	var timestamps []int
+	for cursor := block; cursor != nil && len(timestamps) < medianTimeSpan; {
+		timestamps = append(timestamps, cursor.Timestamp)
+		parent, err := parentOf(cursor)
+		if err != nil { // acceptBlock makes sure the blocks before a new block are stored, so this is only an old broken database
+			break
+		}
+		cursor = parent
+	}
+	sort.Ints(timestamps)
+	return timestamps[len(timestamps)/2]
+}
@@ -2,50 +2,66 @@ package blockchain
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/jeyoungjung/zerocoin/db"
 	"github.com/jeyoungjung/zerocoin/utils"
 	"github.com/jeyoungjung/zerocoin/wallet"
 )
 
 const (
-	minerReward int = 50
+	feeRateUnit int = 1000 // fee rates are the fee for every 1000 bytes
 )
 
 type Tx struct {
+	Version   int      `json:"version"`
 	ID        string   `json:"id"`
 	Timestamp int      `json:"timestamp"`
+	LockTime  int      `json:"lockTime,omitempty"` // 0, or the block height (or unix time) the transaction can't be confirmed before
 	TxIns     []*TxIn  `json:"txIns"`
 	TxOuts    []*TxOut `json:"txOuts"`
 }
 
+// calculateID hashes the canonical bytes of the transaction without the signatures
+func (t *Tx) calculateID() string {
+	return utils.HashBytes(t.encode(false))
+}
+
 func (t *Tx) hashId() {
-	t.ID = utils.Hash(t)
+	t.ID = t.calculateID()
 }
 
 type TxIn struct {
-	TxID      string `json:"txid"`
-	Index     int    `json:"index"`
-	Signature string `json:"signature"`
+	TxID        string `json:"txid"`
+	Index       int    `json:"index"`
+	LockBlocks  int    `json:"lockBlocks,omitempty"`  // blocks the spent output has to be confirmed for before this can be confirmed
+	LockSeconds int    `json:"lockSeconds,omitempty"` // the same in seconds of median time past
+	Signature   string `json:"signature"`             // the unlocking script, for an output paying a plain address it's just the signature
 }
 
 type TxOut struct {
-	Address string `json:"address"`
+	Address string `json:"address"` // a public key, or the hash of Script
 	Amount  int    `json:"amount"`
+	Script  string `json:"script,omitempty"` // the locking script, a plain address is locked by the signature of its key without one
 }
 
 type UTxOut struct {
-	TxID   string
-	Index  int
-	Amount int
+	TxID         string
+	Index        int
+	Amount       int
+	MatureHeight int  `json:",omitempty"` // only for coinbase outputs that can't be spent yet, the first height they can be spent at
+	Unconfirmed  bool `json:",omitempty"` // made by a transaction that is still in the mempool
 }
 
 // mempool is where transactions are held before verification, it just stays in the memory
 type mempool struct {
 	// no need to go to the database
-	Txs map[string]*Tx `json:"txs"` // "txID" : tx
-	m   sync.Mutex
+	Txs     map[string]*Tx           `json:"txs"` // "txID" : tx
+	entries map[string]*mempoolEntry // the fee, size and age of every transaction
+	m       sync.Mutex
 }
 
 var m *mempool
@@ -54,22 +70,76 @@ var memOnce sync.Once
 func Mempool() *mempool {
 	memOnce.Do(func() {
 		m = &mempool{
-			Txs: make(map[string]*Tx),
+			Txs:     make(map[string]*Tx),
+			entries: make(map[string]*mempoolEntry),
 		}
 	})
 	return m
 }
 
+// add puts the transaction into the mempool and saves it, so it's not lost if the node restarts
+func (m *mempool) add(tx *Tx, fee int) {
+	m.Txs[tx.ID] = tx
+	m.entries[tx.ID] = &mempoolEntry{fee, tx.size(), int(time.Now().Unix())}
+	m.save(tx.ID)
+}
+
+// save writes the transaction and when it got to us to the database
+func (m *mempool) save(id string) {
+	db.SaveMempoolTx(id, utils.EncodeToBytes(mempoolRecord{m.Txs[id], m.entries[id].added}))
+}
+
+// remove takes the transaction out of the mempool and the database
+func (m *mempool) remove(id string) {
+	if _, ok := m.Txs[id]; !ok { // most transactions of a new block never were in our mempool
+		return
+	}
+	delete(m.Txs, id)
+	delete(m.entries, id)
+	db.DeleteMempoolTx(id)
+}
+
+// restoreMempool loads the transactions saved before the node stopped.
+// the blockchain might have changed since then, so each one is checked again and the ones that are not valid anymore are dropped
+func restoreMempool(b *blockchain) {
+	var txs []*Tx
+	added := make(map[string]int)
+	for _, data := range db.GetMempoolTxs() {
+		record := &mempoolRecord{}
+		utils.DecodeFromBytesToStruct(data, record)
+		db.DeleteMempoolTx(record.Tx.ID) // the valid ones are saved again by addToMempool
+		txs = append(txs, record.Tx)
+		added[record.Tx.ID] = record.Added
+	}
+	sort.Slice(txs, func(i, j int) bool { // the ones that got to us first win if two spend the same money
+		return added[txs[i].ID] < added[txs[j].ID]
+	})
+	Mempool()                                   // makes sure m exists, addToMempool uses it directly
+	for _, tx := range orderParentsFirst(txs) { // a transaction spending an unconfirmed output needs its parent in first
+		if err := addToMempool(b, tx); err != nil {
+			fmt.Printf("Dropped transaction %s from the mempool: %s\n", tx.ID, err)
+			continue
+		}
+		if entry, ok := m.entries[tx.ID]; ok { // it keeps the age it had before the restart
+			entry.added = added[tx.ID]
+			m.save(tx.ID)
+		}
+	}
+	m.trim() // some of them might have expired while the node was stopped
+}
+
 // coinbase transaction is the first transaction in a block,
-// where the reward is given to the miner, added immediately when a block in added to the blockchain
-func makeCoinbaseTx(address string) *Tx {
+// where the subsidy and the fees of the block are given to the miner, added immediately when a block in added to the blockchain
+// the index of its input is the height of the block, so two coinbases paying the same miner never have the same id
+func makeCoinbaseTx(address string, height int, fees int) *Tx {
 	txIns := []*TxIn{
-		{"", -1, "COINBASE"},
+		{TxID: "", Index: height, Signature: "COINBASE"},
 	}
 	txOuts := []*TxOut{
-		{address, minerReward},
+		{Address: address, Amount: monetaryPolicy.subsidy(height) + fees},
 	}
 	tx := Tx{
+		Version:   txVersion,
 		ID:        "",
 		Timestamp: int(time.Now().Unix()),
 		TxIns:     txIns,
@@ -81,29 +151,68 @@ func makeCoinbaseTx(address string) *Tx {
 
 // sign makes signature for txIn
 func (tx *Tx) sign() {
-	for _, txIn := range tx.TxIns {
-		txIn.Signature = wallet.Sign(tx.ID, wallet.Wallet())
+	for i, txIn := range tx.TxIns {
+		txIn.Signature = wallet.Sign(tx.sigHash(i), wallet.Wallet())
 	}
 }
 
-// validate checks the ownership of the money
-func validate(tx *Tx) bool {
-	valid := true
+// addToMempool runs every check a transaction has to pass before it goes into the mempool,
+// the same ones a block would do and then the ones against the other transactions of the mempool.
+// the caller has to hold the locks of b and the mempool
+func addToMempool(b *blockchain, tx *Tx) error {
+	if tx == nil {
+		return ErrTxEmpty
+	}
+	if _, ok := m.Txs[tx.ID]; ok {
+		return ErrTxKnown
+	}
+	fee, err := validateTx(tx, m.lookup, b.Height+1, nextMedianTime(b)) // it would be in the next block, or after its parents in the mempool
+	if err != nil {
+		return err
+	}
+	dataOutputs := 0
+	for _, txOut := range tx.TxOuts { // any script is valid in a block, but we only relay the ones wallets know how to spend
+		if txOut.isData() {
+			dataOutputs++
+			continue
+		}
+		if txOut.Script != "" && !isStandardScript(txOut.Script) {
+			return ErrTxNonStandard
+		}
+	}
+	if dataOutputs > 1 { // one is enough to commit to any amount of data with a hash
+		return ErrTxNonStandard
+	}
+	ancestors := make(map[string]bool)
 	for _, txIn := range tx.TxIns {
-		prevTx := FindTx(Blockchain(), txIn.TxID) // find a tx with the same ID as the txIn
-		if prevTx == nil {                        // if there is none, it means that there was no tx with the same ID as txIn (no such money)
-			valid = false
-			break
+		for _, ancestor := range m.ancestors(txIn.TxID, nil) {
+			ancestors[ancestor.ID] = true
 		}
-		address := prevTx.TxOuts[txIn.Index].Address // if there is such tx with the same ID as the txIn,
-		// get the txOut.address of that tx, and verify it with the signature of the txIn
-		// if that txOut was owned by the owner of this txIn, it would be verifed, if not, it won't be verified
-		valid = wallet.Verify(txIn.Signature, tx.ID, address)
-		if !valid {
-			break
+	}
+	if len(ancestors)+1 > maxAncestors { // long chains make picking the transactions of a block slow
+		return ErrTooManyAncestors
+	}
+	// only one of two transactions spending the same money can be confirmed,
+	// so the new one has to pay enough to replace the old one and everything spending its outputs
+	replaced := m.replaced(tx)
+	if len(replaced) > 0 {
+		if err := m.checkReplacement(tx, fee, replaced); err != nil {
+			return err
 		}
 	}
-	return valid
+	// a full mempool could drop it right away, then nothing it would replace or push out can be removed for it
+	dropped := m.with(tx, fee, replaced).trimmed()
+	if dropped[tx.ID] { // it has the lowest fee rate
+		return ErrMempoolFull
+	}
+	for id := range replaced {
+		m.remove(id)
+	}
+	m.add(tx, fee)
+	for id := range dropped {
+		m.remove(id)
+	}
+	return nil
 }
 
 // isOnMempool checks if the uTxOut already exists on the mempool
@@ -123,112 +232,284 @@ Outer: // this is called a "label"
 }
 
 var ErrorNoMoney = errors.New("not enough funds")
-var ErrorNotValid = errors.New("Tx Invalid")
+var ErrorInvalidFee = errors.New("fee and fee rate can't be negative")
+var ErrorCantBump = errors.New("only transactions spending our own money can be bumped")
+var ErrorNoPayments = errors.New("a transaction has to pay at least one address")
 
-// makeTx creates the transactions
-func makeTx(from, to string, amount int) (*Tx, error) {
-	if TotalBalanceByAddress(from, Blockchain()) < amount {
-		return nil, ErrorNoMoney
-	}
-	var txOuts []*TxOut
-	var txIns []*TxIn
-	total := 0
-	uTxOuts := UTxOutsByAddress(from, Blockchain()) // gets the unspent transaction output for "from"
-	for _, uTxOut := range uTxOuts {
-		if total >= amount {
-			break
+// size is the amount of bytes of the transaction, what the fee rate is measured against
+func (t *Tx) size() int {
+	return len(t.encode(true))
+}
+
+// fee is what the transaction leaves for the miner, the inputs minus the outputs
+func (t *Tx) fee(lookup txOutLookup) int {
+	fee := 0
+	for _, txIn := range t.TxIns {
+		if prev := lookup(txIn.TxID, txIn.Index); prev != nil {
+			fee += prev.Output.Amount
 		}
-		txIn := &TxIn{uTxOut.TxID, uTxOut.Index, from}
-		txIns = append(txIns, txIn)
-		total += uTxOut.Amount
 	}
-	if change := total - amount; change != 0 {
-		changeTxOut := &TxOut{from, change}
-		txOuts = append(txOuts, changeTxOut)
+	for _, txOut := range t.TxOuts {
+		fee -= txOut.Amount
 	}
-	txOut := &TxOut{to, amount}
-	txOuts = append(txOuts, txOut)
-	tx := &Tx{
-		ID:        "",
-		Timestamp: int(time.Now().Unix()),
-		TxIns:     txIns,
-		TxOuts:    txOuts,
+	return fee
+}
+
+// feeForSize is the fee needed for size bytes at feeRate, rounded up
+func feeForSize(feeRate, size int) int {
+	return (feeRate*size + feeRateUnit - 1) / feeRateUnit
+}
+
+// makeTx creates the transactions, one transaction can pay many addresses and has at most one change output
+// the fee is left out of the outputs for the miner. if feeRate is not 0, the fee is at least feeRate for every 1000 bytes of the transaction
+func makeTx(from string, payments []*TxOut, fee, feeRate int, locks TxLocks) (*Tx, error) {
+	uTxOuts := UTxOutsByAddress(from, Blockchain()) // gets the unspent transaction output for "from"
+	return buildTx(from, uTxOuts, payments, fee, feeRate, locks)
+}
+
+// buildTx spends the uTxOuts of from, in order, until the payments and the fee are covered,
+// and sends what is left back to from as change. every input gets the same relative locks
+func buildTx(from string, uTxOuts []*UTxOut, payments []*TxOut, fee, feeRate int, locks TxLocks) (*Tx, error) {
+	// the address is as long as a signature, so the size is already right
+	tx, err := buildUnsignedTx(&TxOut{Address: from}, from, uTxOuts, payments, fee, feeRate, locks)
+	if err != nil {
+		return nil, err
 	}
-	tx.hashId()
 	tx.sign()
-	valid := validate(tx)
-	if !valid {
-		return nil, ErrorNotValid
+	return tx, nil
+}
+
+// buildUnsignedTx makes the transaction for buildTx without signing it. change is the output what is left goes to,
+// and every input gets unlock as its unlocking script until it's signed. it has to be as long as the real one, so the fee covers it
+func buildUnsignedTx(change *TxOut, unlock string, uTxOuts []*UTxOut, payments []*TxOut, fee, feeRate int, locks TxLocks) (*Tx, error) {
+	if fee < 0 || feeRate < 0 {
+		return nil, ErrorInvalidFee
 	}
+	if locks.LockTime < 0 || locks.LockBlocks < 0 || locks.LockSeconds < 0 {
+		return nil, ErrTxInvalidLock
+	}
+	if len(payments) == 0 {
+		return nil, ErrorNoPayments
+	}
+	amount := 0
+	for _, payment := range payments {
+		if payment == nil || (payment.Amount <= 0 && !payment.isData()) { // a negative payment would make the inputs look like enough
+			return nil, ErrTxInvalidAmount
+		}
+		if payment.Script != "" && payment.Address == "" && !payment.isData() { // paying a script is paying its address
+			payment.Address = ScriptAddress(payment.Script)
+		}
+		amount += payment.Amount
+	}
+	var tx *Tx
+	for {
+		var txOuts []*TxOut
+		var txIns []*TxIn
+		total := 0
+		for _, uTxOut := range uTxOuts {
+			if total >= amount+fee && len(txIns) > 0 { // a transaction only carrying data still needs an input
+				break
+			}
+			txIn := &TxIn{uTxOut.TxID, uTxOut.Index, locks.LockBlocks, locks.LockSeconds, unlock}
+			txIns = append(txIns, txIn)
+			total += uTxOut.Amount
+		}
+		if total < amount+fee || len(txIns) == 0 {
+			return nil, ErrorNoMoney
+		}
+		if left := total - amount - fee; left != 0 {
+			changeTxOut := &TxOut{Address: change.Address, Amount: left, Script: change.Script}
+			txOuts = append(txOuts, changeTxOut)
+		}
+		txOuts = append(txOuts, payments...)
+		tx = &Tx{
+			Version:   txVersion,
+			ID:        "",
+			Timestamp: int(time.Now().Unix()),
+			LockTime:  locks.LockTime,
+			TxIns:     txIns,
+			TxOuts:    txOuts,
+		}
+		// more inputs make the transaction bigger and the fee higher, so keep going until the fee covers the size
+		if neededFee := feeForSize(feeRate, tx.size()); neededFee > fee {
+			fee = neededFee
+			continue
+		}
+		break
+	}
+	tx.hashId()
 	return tx, nil
 }
 
-func (m *mempool) AddTx(to string, amount int) (*Tx, error) {
-	tx, err := makeTx(wallet.Wallet().Address, to, amount)
+// AddTx sends every payment from our wallet in one transaction, leaving the fee for the miner
+// either a fixed fee or a fee rate (per 1000 bytes) can be given.
+// a transaction with locks that haven't passed yet is rejected, it has to be sent again once they have
+func (m *mempool) AddTx(payments []*TxOut, fee, feeRate int, locks TxLocks) (*Tx, error) {
+	tx, err := makeTx(wallet.Wallet().Address, payments, fee, feeRate, locks)
 	if err != nil {
 		return nil, err
 	}
-	m.Txs[tx.ID] = tx // add the transaction to the mempool
+	b := Blockchain()
+	b.m.Lock() // the same order as addBlock, or the two could wait on each other forever
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	if err := addToMempool(b, tx); err != nil { // our own transactions are checked the same way as a peer's
+		return nil, err
+	}
 	return tx, nil
 }
 
-func (m *mempool) TxToConfirm() []*Tx {
-	coinbase := makeCoinbaseTx(wallet.Wallet().Address) // adds the coinbase transaction right away
-	var txs []*Tx
-	for _, tx := range m.Txs { // goes through all the transactions inside the mempool
-		txs = append(txs, tx)
+// BumpTx replaces one of our transactions that is stuck in the mempool with one making the same payments for a higher fee.
+// the new fee is at least fee, at least feeRate for every 1000 bytes, and always enough to replace the old transaction.
+// a transaction only paying us, like one putting our outputs together, spends the same inputs with the fee taken from what comes back.
+// the transactions spending the outputs of the old one can't stay without it, their ids are returned so they can be sent again
+func (m *mempool) BumpTx(id string, fee, feeRate int) (*Tx, []string, error) {
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	old, ok := m.Txs[id]
+	if !ok {
+		return nil, nil, ErrTxNotFound
 	}
-	txs = append([]*Tx{coinbase}, txs...) // coinbase transaction is prepended (appended to the front)
-	// https://medium.com/@tzuni_eh/go-append-prepend-item-into-slice-a4bf167eb7af
-	m.Txs = make(map[string]*Tx) // empty mempool
-	return txs
-}
-
-// hardest function to understand
-// Inside a transaction inside a block, it always starts with a coinbase transaction (reward given when a block is mined)
-// and the transaction ITSELF has an "id".
-// If a transaction was to be made between 2 people, and there is sufficient fund in that transaction's txOut,
-// the TxID of that transaction's txIn (between 2 people) would have the same TxID as the "id" of the actual transaction.
-// Notice how the TxID of every coinbase transaction is just empty, that part should be the same as the actual id
-// of the transaction.
-// Conclusion: ID is the same if you used money from that transaction
-func UTxOutsByAddress(address string, b *blockchain) []*UTxOut { // this function finds all of the TxOuts that haven't been used by an input yet
-	// so basically finding the unused money, aka remaining balance
+	from := wallet.Wallet().Address
 	var uTxOuts []*UTxOut
-	creatorTxs := make(map[string]bool)
-	for _, block := range GetBlockchain(b) { // inside block
-		for _, tx := range block.Transactions { // inside transactions
-			for _, input := range tx.TxIns { // inside transaction inputs
-				if input.Signature == "COINBASE" {
-					break
-				}
-				if FindTx(b, input.TxID).TxOuts[input.Index].Address == address {
-					// if the ID of the txOut is same as the txIn, that txOut has been used by that txIn,
-					// so add that ID to the map
-					creatorTxs[input.TxID] = true // here input.tx id is same as tx.id
-				}
+	for _, txIn := range old.TxIns { // the old inputs go first, so the new transaction spends them again and replaces the old one
+		u := m.lookup(txIn.TxID, txIn.Index)
+		if u == nil || u.Output.Address != from {
+			return nil, nil, ErrorCantBump
+		}
+		uTxOuts = append(uTxOuts, &UTxOut{TxID: u.TxID, Index: u.Index, Amount: u.Output.Amount})
+	}
+	inputs := sumUTxOuts(uTxOuts)
+	var payments []*TxOut
+	for _, txOut := range old.TxOuts {
+		if txOut.Address != from { // what came back to us was change, buildTx makes new change
+			payments = append(payments, txOut)
+		}
+	}
+	toSelf := len(payments) == 0
+	replaced := m.replaced(old)
+	if !toSelf { // in case the old inputs are not enough for the higher fee
+		spendable, _ := uTxOutsByAddress(from, b)
+		for _, uTxOut := range spendable {
+			if !replaced[uTxOut.TxID] { // the change of the old transaction is gone once it's replaced
+				uTxOuts = append(uTxOuts, uTxOut)
 			}
-			for index, output := range tx.TxOuts {
-				if output.Address == address {
-					if _, ok := creatorTxs[tx.ID]; !ok {
-						uTxOut := &UTxOut{tx.ID, index, output.Amount}
-						if !isOnMempool(uTxOut) {
-							uTxOuts = append(uTxOuts, uTxOut)
-						}
-					}
-				}
+		}
+	}
+	locks := TxLocks{LockTime: old.LockTime} // the payments keep their locks
+	if len(old.TxIns) > 0 {
+		locks.LockBlocks, locks.LockSeconds = old.TxIns[0].LockBlocks, old.TxIns[0].LockSeconds
+	}
+	for {
+		buildFeeRate := feeRate
+		if toSelf { // the fee comes out of the payment, so it's worked out here instead of by buildTx
+			payments = []*TxOut{{Address: from, Amount: inputs - fee}}
+			buildFeeRate = 0
+		}
+		tx, err := buildTx(from, uTxOuts, payments, fee, buildFeeRate, locks)
+		if err != nil {
+			return nil, nil, err
+		}
+		// more inputs make it bigger and the replacement fee higher, so keep going until the fee is enough
+		needed := m.replacementFee(replaced, tx.size())
+		if toSelf && feeForSize(feeRate, tx.size()) > needed {
+			needed = feeForSize(feeRate, tx.size())
+		}
+		if tx.fee(m.lookup) < needed {
+			fee = needed
+			continue
+		}
+		if err := addToMempool(b, tx); err != nil {
+			return nil, nil, err
+		}
+		var evicted []string
+		for replacedID := range replaced {
+			if replacedID != old.ID {
+				evicted = append(evicted, replacedID)
+			}
+		}
+		sort.Strings(evicted)
+		return tx, evicted, nil
+	}
+}
+
+// TxToConfirm returns the transactions for the next block, the highest fee rates first, until maxSize bytes are used,
+// and the fees they pay. they stay in the mempool until the block is connected to the blockchain, in case the block ends up on a side branch
+func (m *mempool) TxToConfirm(maxSize int) ([]*Tx, int) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.selectTxs(maxSize)
+}
+
+// uTxOutsByAddress splits the unspent outputs of the address into the ones that can be spent in the next block
+// and the coinbase outputs that are not mature yet. outputs already used by a transaction in the mempool are left out,
+// and outputs made by transactions in the mempool can be spent too.
+// the caller has to hold the locks of b and the mempool
+func uTxOutsByAddress(address string, b *blockchain) (spendable []*UTxOut, immature []*UTxOut) {
+	for _, u := range unspentOutputsByAddress(address) {
+		uTxOut := &UTxOut{TxID: u.TxID, Index: u.Index, Amount: u.Output.Amount}
+		if isOnMempool(uTxOut) {
+			continue
+		}
+		if !u.matureAt(b.Height + 1) {
+			uTxOut.MatureHeight = u.Height + monetaryPolicy.CoinbaseMaturity
+			immature = append(immature, uTxOut)
+			continue
+		}
+		spendable = append(spendable, uTxOut)
+	}
+	for _, tx := range orderParentsFirst(Mempool().byID()) { // after the confirmed ones, so those are spent first
+		for index, txOut := range tx.TxOuts {
+			uTxOut := &UTxOut{TxID: tx.ID, Index: index, Amount: txOut.Amount, Unconfirmed: true}
+			if txOut.Address == address && !isOnMempool(uTxOut) {
+				spendable = append(spendable, uTxOut)
 			}
 		}
 	}
-	return uTxOuts
+	return spendable, immature
+}
+
+// UTxOutsByAddress finds all of the TxOuts sent to the address that haven't been used by an input yet,
+// so basically finding the unused money, aka remaining balance.
+// coinbase outputs that are not mature yet can't be spent, so they are left out
+func UTxOutsByAddress(address string, b *blockchain) []*UTxOut {
+	b.m.Lock()
+	defer b.m.Unlock()
+	Mempool().m.Lock()
+	defer m.m.Unlock()
+	spendable, _ := uTxOutsByAddress(address, b)
+	return spendable
+}
+
+// ImmatureUTxOutsByAddress finds the coinbase outputs of the address that can't be spent yet
+func ImmatureUTxOutsByAddress(address string, b *blockchain) []*UTxOut {
+	b.m.Lock()
+	defer b.m.Unlock()
+	Mempool().m.Lock()
+	defer m.m.Unlock()
+	_, immature := uTxOutsByAddress(address, b)
+	return immature
 }
 
 // TotalBalanceByAddress finds the total balance for a specific address
-func TotalBalanceByAddress(address string, b *blockchain) int {
-	txOuts := UTxOutsByAddress(address, b) // Gathered txOuts for that address
+// the first amount can be spent now, the second is coinbase money that is not mature yet
+func TotalBalanceByAddress(address string, b *blockchain) (int, int) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	Mempool().m.Lock()
+	defer m.m.Unlock()
+	spendable, immature := uTxOutsByAddress(address, b) // Gathered txOuts for that address
+	return sumUTxOuts(spendable), sumUTxOuts(immature)
+}
+
+func sumUTxOuts(uTxOuts []*UTxOut) int {
 	var amount int
-	for _, txOut := range txOuts {
-		amount += txOut.Amount
+	for _, uTxOut := range uTxOuts {
+		amount += uTxOut.Amount
 	}
 	return amount
 }
@@ -242,20 +523,25 @@ func GetTxs(b *blockchain) []*Tx {
 	return txs
 }
 
-// FindTx returns a transaction with the targetID
+// FindTx returns a confirmed transaction with the targetID
 func FindTx(b *blockchain, targetID string) *Tx {
-	for _, tx := range GetTxs(b) {
-		if tx.ID == targetID {
-			return tx
-		}
+	location := findTxLocation(targetID)
+	if location == nil {
+		return nil
 	}
-	return nil
+	block, err := FindBlock(location.BlockHash)
+	utils.HandleErr(err)
+	return block.Transactions[location.Position]
 }
 
 // AddPeerTx adds the new transaction from the peer to the current mempool
 // AddPeerTx is called everytime a new transaction is made by someone
-func (m *mempool) AddPeerTx(tx *Tx) {
+// if the transaction is not valid it returns the reason and it's not added
+func (m *mempool) AddPeerTx(tx *Tx) error {
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
 	m.m.Lock()
 	defer m.m.Unlock()
-	m.Txs[tx.ID] = tx
+	return addToMempool(b, tx)
 }
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/jeyoungjung/zerocoin/db"
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+var ErrTxNotFound = errors.New("this transaction is not in the blockchain or the mempool")
+
+// txLocation is where a confirmed transaction is, the block and its position inside the block's transactions
+type txLocation struct {
+	BlockHash string
+	Position  int
+}
+
+// TxStatus is a transaction along with where it is confirmed, or if it's still waiting in the mempool
+type TxStatus struct {
+	Tx            *Tx    `json:"transaction"`
+	BlockHash     string `json:"blockHash,omitempty"`
+	BlockHeight   int    `json:"blockHeight,omitempty"`
+	Confirmations int    `json:"confirmations"`
+	InMempool     bool   `json:"inMempool"`
+}
+
+// indexTxs saves the location of every transaction of the block, which transaction spent each output
+// and the data the transactions carry
+func indexTxs(block *Block) {
+	locations := make(map[string][]byte)
+	spenders := make(map[string]string)
+	data := txData(block)
+	for position, tx := range block.Transactions {
+		locations[tx.ID] = utils.EncodeToBytes(txLocation{block.Hash, position})
+		if position > 0 { // the coinbase doesn't spend anything
+			for _, txIn := range tx.TxIns {
+				spenders[outpointKey(txIn.TxID, txIn.Index)] = tx.ID
+			}
+		}
+	}
+	db.SaveTxLocations(locations)
+	db.SaveTxSpenders(spenders)
+	db.SaveTxData(data)
+}
+
+// txData returns the data carried by the data outputs of the block's transactions
+func txData(block *Block) []db.DataEntry {
+	var entries []db.DataEntry
+	for _, tx := range block.Transactions {
+		for _, txOut := range tx.TxOuts {
+			if data, ok := txOut.data(); ok {
+				entries = append(entries, db.DataEntry{Data: data, TxID: tx.ID})
+			}
+		}
+	}
+	return entries
+}
+
+// unindexTxs deletes the location of every transaction of the block and the spenders and data it saved
+func unindexTxs(block *Block) {
+	var ids, outpoints []string
+	for position, tx := range block.Transactions {
+		ids = append(ids, tx.ID)
+		if position > 0 {
+			for _, txIn := range tx.TxIns {
+				outpoints = append(outpoints, outpointKey(txIn.TxID, txIn.Index))
+			}
+		}
+	}
+	db.DeleteTxLocations(ids)
+	db.DeleteTxSpenders(outpoints)
+	db.DeleteTxData(txData(block))
+}
+
+// findTxLocation returns where the confirmed transaction is, or nil if it isn't confirmed
+func findTxLocation(id string) *txLocation {
+	data := db.GetTxLocation(id)
+	if data == nil {
+		return nil
+	}
+	location := &txLocation{}
+	utils.DecodeFromBytesToStruct(data, location)
+	return location
+}
+
+// FindTxStatus returns the transaction with the id, if it is confirmed, how many blocks confirm it
+func FindTxStatus(b *blockchain, id string) (*TxStatus, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if location := findTxLocation(id); location != nil {
+		block, err := FindBlock(location.BlockHash)
+		utils.HandleErr(err)
+		return &TxStatus{
+			Tx:            block.Transactions[location.Position],
+			BlockHash:     block.Hash,
+			BlockHeight:   block.Height,
+			Confirmations: b.Height - block.Height + 1, // the block itself is the first confirmation
+		}, nil
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	if tx, ok := m.Txs[id]; ok {
+		return &TxStatus{Tx: tx, InMempool: true}, nil
+	}
+	return nil, ErrTxNotFound
+}
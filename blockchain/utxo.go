@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"github.com/jeyoungjung/zerocoin/db"
+	"github.com/jeyoungjung/zerocoin/utils"
+)
+
+// unspentOutput is what the utxo bucket keeps for every output that hasn't been spent yet
+// Height is the height of the block that made it, Coinbase is true if it was made by the block's coinbase
+type unspentOutput struct {
+	TxID     string
+	Index    int
+	Output   *TxOut
+	Height   int
+	Coinbase bool
+}
+
+// matureAt tells if the output can be spent by a transaction in the block at the height
+func (u *unspentOutput) matureAt(height int) bool {
+	return !u.Coinbase || height >= u.Height+monetaryPolicy.CoinbaseMaturity
+}
+
+func (u *unspentOutput) entry() db.UTxOEntry {
+	return db.UTxOEntry{
+		Key:     outpointKey(u.TxID, u.Index),
+		Address: u.Output.Address,
+		Data:    utils.EncodeToBytes(u),
+	}
+}
+
+func restoreUnspentOutput(data []byte) *unspentOutput {
+	u := &unspentOutput{}
+	utils.DecodeFromBytesToStruct(data, u)
+	return u
+}
+
+// getUTxOut returns the unspent output at txID:index, or nil if it doesn't exist or was spent
+func getUTxOut(txID string, index int) *unspentOutput {
+	data := db.GetUTxO(outpointKey(txID, index))
+	if data == nil {
+		return nil
+	}
+	return restoreUnspentOutput(data)
+}
+
+// unspentOutputsByAddress returns every unspent output sent to the address
+func unspentOutputsByAddress(address string) []*unspentOutput {
+	var outputs []*unspentOutput
+	for _, data := range db.GetUTxOsByAddress(address) {
+		outputs = append(outputs, restoreUnspentOutput(data))
+	}
+	return outputs
+}
+
+// connectUTxOs spends the outputs used by the block and adds the outputs it made.
+// the spent outputs are saved as the block's undo data so disconnectUTxOs can bring them back
+func connectUTxOs(block *Block) {
+	var spent []*unspentOutput
+	created := make(map[string]*unspentOutput)
+	var order []string // keeps the created outputs in the order of the block
+	for _, tx := range block.Transactions {
+		coinbase := tx.isCoinbase()
+		if !coinbase {
+			for _, txIn := range tx.TxIns {
+				key := outpointKey(txIn.TxID, txIn.Index)
+				if _, ok := created[key]; ok { // made and spent in the same block, it never goes into the database
+					delete(created, key)
+					continue
+				}
+				data := db.GetUTxO(key)
+				if data == nil { // the block was validated, so this can only happen if the database is broken
+					utils.HandleErr(ErrTxMissingInput)
+				}
+				spent = append(spent, restoreUnspentOutput(data))
+			}
+		}
+		for index, txOut := range tx.TxOuts {
+			if txOut.isData() { // it can never be spent, so there is no need to keep it
+				continue
+			}
+			key := outpointKey(tx.ID, index)
+			created[key] = &unspentOutput{tx.ID, index, txOut, block.Height, coinbase}
+			order = append(order, key)
+		}
+	}
+	var spentEntries, createdEntries []db.UTxOEntry
+	for _, u := range spent {
+		spentEntries = append(spentEntries, u.entry())
+	}
+	for _, key := range order {
+		if u, ok := created[key]; ok {
+			createdEntries = append(createdEntries, u.entry())
+		}
+	}
+	db.SaveUndo(block.Hash, utils.EncodeToBytes(spent))
+	db.UpdateUTxOs(block.Hash, spentEntries, createdEntries)
+}
+
+// disconnectUTxOs removes the outputs made by the block and brings back the outputs it spent
+func disconnectUTxOs(block *Block) {
+	var spent []*unspentOutput
+	utils.DecodeFromBytesToStruct(db.GetUndo(block.Hash), &spent)
+	var removed, restored []db.UTxOEntry
+	for _, tx := range block.Transactions {
+		for index, txOut := range tx.TxOuts {
+			if txOut.isData() {
+				continue
+			}
+			removed = append(removed, (&unspentOutput{TxID: tx.ID, Index: index, Output: txOut}).entry())
+		}
+	}
+	for _, u := range spent {
+		restored = append(restored, u.entry())
+	}
+	db.UpdateUTxOs(block.PrevHash, removed, restored)
+}
+
+// rebuildIndexes throws away the unspent outputs, the transaction locations and the heights
+// and makes them again from every block of b, used when the database was made before they were kept or they are out of date
+func rebuildIndexes(b *blockchain) {
+	db.EmptyIndexes()
+	allBlocks := blocks(b)
+	for i := len(allBlocks) - 1; i >= 0; i-- { // from the genesis block to the newest block
+		db.SaveBlockHeight(allBlocks[i].Height, allBlocks[i].Hash)
+		indexTxs(allBlocks[i])
+		connectUTxOs(allBlocks[i])
+	}
+}
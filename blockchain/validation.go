@@ -0,0 +1,343 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	maxBlockSize       int = 100000 // the transactions of a block can't be bigger than this many bytes
+	maxFutureBlockTime int = 6 * 60 // a block can't be more than 6 minutes (3 blocks of proof of work) ahead of the network time,
+	// it's short because the difficulty is recalculated every block and a timestamp far in the future would make it easier
+)
+
+// errors returned when a block from a peer is rejected
+var (
+	ErrEmptyBlock         = errors.New("block is empty")
+	ErrBlockKnown         = errors.New("block is already in the blockchain")
+	ErrOrphanBlock        = errors.New("block's previous block is unknown")
+	ErrInvalidBranch      = errors.New("block is on a branch with an invalid block")
+	ErrInvalidHeight      = errors.New("block height is not one more than its previous block")
+	ErrWrongDifficulty    = errors.New("block bits are not the expected target")
+	ErrInvalidBlockHash   = errors.New("block hash doesn't match its header")
+	ErrInvalidProofOfWork = errors.New("block hash is bigger than the target")
+	ErrInvalidSeal        = errors.New("block seal is not valid")
+	ErrInvalidTimestamp   = errors.New("block timestamp is out of range")
+	ErrInvalidCoinbase    = errors.New("block must start with exactly one coinbase for its height")
+	ErrInvalidReward      = errors.New("coinbase must pay exactly the subsidy for its height and the fees of the block")
+	ErrFeesOutOfRange     = errors.New("block fees are bigger than the max supply")
+	ErrDuplicateTx        = errors.New("block contains the same transaction twice")
+	ErrInvalidMerkleRoot  = errors.New("block merkle root does not match its transactions")
+	ErrInvalidWitnessRoot = errors.New("block witness root does not match the signatures of its transactions")
+	ErrBlockTooBig        = errors.New("block transactions are bigger than the maximum block size")
+)
+
+// errors returned when a transaction is rejected
+var (
+	ErrTxEmpty          = errors.New("transaction has no inputs or no outputs")
+	ErrTxInvalidID      = errors.New("transaction id is not the hash of the transaction")
+	ErrTxMissingInput   = errors.New("transaction spends an output that doesn't exist or is already spent")
+	ErrTxDoubleSpend    = errors.New("transaction spends the same output twice")
+	ErrTxScriptFailed   = errors.New("transaction input doesn't unlock the output it spends")
+	ErrTxInvalidScript  = errors.New("transaction output script can't be parsed, doesn't match its address or needs a version 3 transaction")
+	ErrTxInvalidData    = errors.New("transaction data output must have no address, no amount and at most 80 bytes of data")
+	ErrTxInvalidAmount  = errors.New("transaction output amount must be positive")
+	ErrTxOverspend      = errors.New("transaction outputs are bigger than its inputs")
+	ErrTxOutOfRange     = errors.New("transaction amount or the sum of its amounts is bigger than the max supply")
+	ErrTxCoinbaseMisuse = errors.New("coinbase input is only allowed in the first transaction of a block")
+	ErrTxImmatureSpend  = errors.New("transaction spends a coinbase output that is not mature yet")
+	ErrTxKnown          = errors.New("transaction is already in the mempool")
+	ErrTxInvalidLock    = errors.New("transaction locks can't be negative and need a version 2 transaction")
+	ErrTxLocked         = errors.New("transaction lock time has not passed yet")
+	ErrTxInputLocked    = errors.New("transaction spends an output that has not been confirmed long enough for its relative lock")
+)
+
+// txOutLookup finds the unspent output for txID:index, or returns nil if there is no such unspent output
+type txOutLookup func(txID string, index int) *unspentOutput
+
+func outpointKey(txID string, index int) string {
+	return fmt.Sprintf("%s:%d", txID, index)
+}
+
+func (t *Tx) isCoinbase() bool {
+	return len(t.TxIns) == 1 && t.TxIns[0].TxID == "" && t.TxIns[0].Signature == "COINBASE"
+}
+
+// validateBlockHeader checks that the block was properly mined on top of its parent
+// parent is nil for the genesis block
+func validateBlockHeader(block *Block, parent *Block) error {
+	if block.Version != blockVersion {
+		return ErrUnknownVersion
+	}
+	height := 1
+	if parent != nil {
+		height = parent.Height + 1
+	}
+	if block.Height != height {
+		return ErrInvalidHeight
+	}
+	bits, err := consensus.NextBits(parent)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return ErrWrongDifficulty
+	}
+	return consensus.VerifySeal(block, parent) // the hash, the seal and the timestamp are up to the consensus
+}
+
+// ValidateTimestamp makes sure the block is newer than the median time of the blocks before it
+// and not too far ahead of the network time. it's what proof of work checks, another Consensus can use it too
+func ValidateTimestamp(block *Block, parent *Block) error {
+	if block.Timestamp > AdjustedTime()+maxFutureBlockTime {
+		return ErrInvalidTimestamp
+	}
+	if parent != nil && block.Timestamp <= medianTimePast(parent) {
+		return ErrInvalidTimestamp
+	}
+	return nil
+}
+
+// validateTxID checks that the id of the transaction is the hash of what it contains
+func validateTxID(tx *Tx) error {
+	if tx == nil {
+		return ErrTxEmpty
+	}
+	for _, txIn := range tx.TxIns { // a peer can send "null" inside the lists, which can't be hashed
+		if txIn == nil {
+			return ErrTxEmpty
+		}
+	}
+	for _, txOut := range tx.TxOuts {
+		if txOut == nil {
+			return ErrTxEmpty
+		}
+	}
+	if tx.Version < 1 || tx.Version > txVersion { // version 1 transactions are still valid, they just can't have locks
+		return ErrUnknownVersion
+	}
+	if err := validateLocks(tx); err != nil {
+		return err
+	}
+	if err := validateOutputScripts(tx); err != nil {
+		return err
+	}
+	if tx.ID != tx.calculateID() {
+		return ErrTxInvalidID
+	}
+	return nil
+}
+
+// validateLocks checks that the locks make sense, whether they have passed depends on the block the transaction is in.
+// version 1 doesn't encode the locks, so they wouldn't be covered by the id or the signatures
+func validateLocks(tx *Tx) error {
+	if tx.LockTime < 0 || (tx.Version < 2 && tx.hasLocks()) {
+		return ErrTxInvalidLock
+	}
+	for _, txIn := range tx.TxIns {
+		if txIn.LockBlocks < 0 || txIn.LockSeconds < 0 {
+			return ErrTxInvalidLock
+		}
+	}
+	return nil
+}
+
+// validateOutputScripts checks that the locking scripts can be parsed and that an output with a script is paid to the script's address,
+// so the outputs of a script can be found by its address. whether an input unlocks them is checked when they are spent
+func validateOutputScripts(tx *Tx) error {
+	for _, txOut := range tx.TxOuts {
+		if txOut.Script == "" {
+			continue
+		}
+		if txOut.isData() { // it has no address, nothing can be paid to it
+			if _, ok := txOut.data(); !ok || tx.Version < 3 || txOut.Address != "" || txOut.Amount != 0 {
+				return ErrTxInvalidData
+			}
+			continue
+		}
+		if tx.Version < 3 || txOut.Address != ScriptAddress(txOut.Script) {
+			return ErrTxInvalidScript
+		}
+		if _, err := parseScript(txOut.Script); err != nil {
+			return ErrTxInvalidScript
+		}
+	}
+	return nil
+}
+
+// validateMerkleRoot checks that the transactions are the ones the block was mined with.
+// the last transaction of an odd level is paired with itself, so repeating it gives the same root (CVE-2012-2459).
+// duplicates have to be rejected here, before the block is stored, or the copy would take the hash of the real block
+func validateMerkleRoot(block *Block) error {
+	seen := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if err := validateTxID(tx); err != nil {
+			return err
+		}
+		if seen[tx.ID] {
+			return ErrDuplicateTx
+		}
+		seen[tx.ID] = true
+	}
+	if block.MerkleRoot == "" || block.MerkleRoot != merkleRoot(block.Transactions) {
+		return ErrInvalidMerkleRoot
+	}
+	if block.WitnessRoot == "" || block.WitnessRoot != witnessRoot(block.Transactions) {
+		return ErrInvalidWitnessRoot
+	}
+	return nil
+}
+
+// validateBlockSize checks that the transactions fit in maxBlockSize, the merkle root has to be checked first
+func validateBlockSize(block *Block) error {
+	size := 0
+	for _, tx := range block.Transactions {
+		size += tx.size()
+	}
+	if size > maxBlockSize {
+		return ErrBlockTooBig
+	}
+	return nil
+}
+
+// validateCoinbase checks that only the first transaction is a coinbase and that it is for the block's height.
+// what it pays is checked with the transactions, since it depends on their fees
+func validateCoinbase(block *Block) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].isCoinbase() || block.Transactions[0].TxIns[0].Index != block.Height {
+		return ErrInvalidCoinbase
+	}
+	reward := 0
+	for _, txOut := range block.Transactions[0].TxOuts {
+		if txOut.Amount <= 0 || !monetaryPolicy.inMoneyRange(txOut.Amount) {
+			return ErrInvalidCoinbase
+		}
+		reward += txOut.Amount
+		if !monetaryPolicy.inMoneyRange(reward) { // a sum that wrapped around could look like the right reward
+			return ErrInvalidCoinbase
+		}
+	}
+	return nil
+}
+
+// validateBlockTxs checks every transaction after the coinbase against the unspent outputs,
+// so the newest block of the blockchain has to be the parent of the block.
+// outputs made earlier in the same block can be spent by later transactions, but nothing can be spent twice.
+func validateBlockTxs(block *Block) error {
+	created := make(map[string]*unspentOutput) // outputs made inside this block
+	spent := make(map[string]bool)             // outputs spent inside this block
+	lookup := func(txID string, index int) *unspentOutput {
+		key := outpointKey(txID, index)
+		if spent[key] {
+			return nil
+		}
+		if u, ok := created[key]; ok {
+			return u
+		}
+		return getUTxOut(txID, index)
+	}
+	medianTime := 0 // what time locks are checked against
+	parent, err := parentOf(block)
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		medianTime = medianTimePast(parent)
+	}
+	fees := 0
+	for i, tx := range block.Transactions { // duplicates were already rejected with the merkle root
+		if i > 0 {
+			fee, err := validateTx(tx, lookup, block.Height, medianTime)
+			if err != nil {
+				return err
+			}
+			fees += fee
+			if !monetaryPolicy.inMoneyRange(fees) {
+				return ErrFeesOutOfRange
+			}
+			for _, txIn := range tx.TxIns {
+				spent[outpointKey(txIn.TxID, txIn.Index)] = true
+			}
+		}
+		for index, txOut := range tx.TxOuts {
+			if !txOut.isData() {
+				created[outpointKey(tx.ID, index)] = &unspentOutput{tx.ID, index, txOut, block.Height, i == 0}
+			}
+		}
+	}
+	reward := 0
+	for _, txOut := range block.Transactions[0].TxOuts {
+		reward += txOut.Amount
+	}
+	if reward != monetaryPolicy.subsidy(block.Height)+fees {
+		return ErrInvalidReward
+	}
+	return nil
+}
+
+// validateTx checks the ownership of every input by running its scripts and that the tx doesn't make money out of nothing
+// height is the height of the block the tx would be in, coinbase outputs have to be mature by then,
+// and medianTime is the median time past of the block before it, the locks of the tx have to have passed by then.
+// it returns the fee of the transaction, what is left of the inputs after the outputs
+func validateTx(tx *Tx, lookup txOutLookup, height, medianTime int) (int, error) {
+	if err := validateTxID(tx); err != nil {
+		return 0, err
+	}
+	if len(tx.TxIns) == 0 || len(tx.TxOuts) == 0 {
+		return 0, ErrTxEmpty
+	}
+	if !tx.isFinal(height, medianTime) {
+		return 0, ErrTxLocked
+	}
+	used := make(map[string]bool)
+	inputTotal := 0
+	for i, txIn := range tx.TxIns {
+		if txIn.Signature == "COINBASE" {
+			return 0, ErrTxCoinbaseMisuse
+		}
+		key := outpointKey(txIn.TxID, txIn.Index)
+		if used[key] {
+			return 0, ErrTxDoubleSpend
+		}
+		used[key] = true
+		prev := lookup(txIn.TxID, txIn.Index)
+		if prev == nil {
+			return 0, ErrTxMissingInput
+		}
+		if !prev.matureAt(height) {
+			return 0, ErrTxImmatureSpend
+		}
+		if !txIn.relativeLockPassed(prev, height, medianTime) {
+			return 0, ErrTxInputLocked
+		}
+		prevTxOut := prev.Output
+		// the unlocking script of the input has to satisfy the locking script of the output, for a plain address it's the signature of its key
+		if err := verifyScript(txIn.Signature, prevTxOut.lockingScript(), tx, i); err != nil {
+			return 0, ErrTxScriptFailed
+		}
+		if !monetaryPolicy.inMoneyRange(prevTxOut.Amount) {
+			return 0, ErrTxOutOfRange
+		}
+		inputTotal += prevTxOut.Amount
+		if !monetaryPolicy.inMoneyRange(inputTotal) {
+			return 0, ErrTxOutOfRange
+		}
+	}
+	outputTotal := 0
+	for _, txOut := range tx.TxOuts {
+		if txOut.Amount <= 0 && !txOut.isData() { // data outputs are checked with the scripts, they pay nothing
+			return 0, ErrTxInvalidAmount
+		}
+		// every amount and every sum is kept under the max supply, so the total can't overflow and wrap around to something small
+		if !monetaryPolicy.inMoneyRange(txOut.Amount) {
+			return 0, ErrTxOutOfRange
+		}
+		outputTotal += txOut.Amount
+		if !monetaryPolicy.inMoneyRange(outputTotal) {
+			return 0, ErrTxOutOfRange
+		}
+	}
+	if outputTotal > inputTotal {
+		return 0, ErrTxOverspend
+	}
+	return inputTotal - outputTotal, nil
+}
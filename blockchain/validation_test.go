@@ -0,0 +1,92 @@
+package blockchain
+
+import "testing"
+
+// anyoneCanSpend is an output locked by OP_1, so a test can spend it without a wallet
+func anyoneCanSpend(amount int) *unspentOutput {
+	return &unspentOutput{
+		TxID:   "prev",
+		Index:  0,
+		Output: &TxOut{Address: ScriptAddress("OP_1"), Amount: amount, Script: "OP_1"},
+		Height: 1,
+	}
+}
+
+func spendingTx(amounts ...int) *Tx {
+	tx := &Tx{
+		Version:   txVersion,
+		Timestamp: 1700000000,
+		TxIns:     []*TxIn{{TxID: "prev", Index: 0, Signature: "OP_1"}},
+	}
+	for _, amount := range amounts {
+		tx.TxOuts = append(tx.TxOuts, &TxOut{Address: "jay", Amount: amount})
+	}
+	tx.hashId()
+	return tx
+}
+
+func TestValidateTxAmounts(t *testing.T) {
+	prev := anyoneCanSpend(10)
+	lookup := func(txID string, index int) *unspentOutput {
+		if txID == prev.TxID && index == prev.Index {
+			return prev
+		}
+		return nil
+	}
+	tests := []struct {
+		name    string
+		amounts []int
+		fee     int
+		err     error
+	}{
+		{"pays less than the input", []int{4, 5}, 1, nil},
+		{"pays more than the input", []int{6, 5}, 0, ErrTxOverspend},
+		{"outputs wrap around to 0", []int{1 << 62, 1 << 62, 1 << 62, 1 << 62}, 0, ErrTxOutOfRange},
+		{"output bigger than the max supply", []int{monetaryPolicy.maxSupply() + 1}, 0, ErrTxOutOfRange},
+		{"outputs add up to more than the max supply", []int{monetaryPolicy.maxSupply(), 1}, 0, ErrTxOutOfRange},
+	}
+	for _, test := range tests {
+		fee, err := validateTx(spendingTx(test.amounts...), lookup, 2, 0)
+		if err != test.err || fee != test.fee {
+			t.Errorf("%s: got fee %d and %v, want fee %d and %v", test.name, fee, err, test.fee, test.err)
+		}
+	}
+}
+
+func TestValidateCoinbaseAmounts(t *testing.T) {
+	coinbase := makeCoinbaseTx("jay", 1, 0)
+	coinbase.TxOuts = []*TxOut{{Address: "jay", Amount: 1 << 62}, {Address: "jay", Amount: 1 << 62}, {Address: "jay", Amount: 1 << 62}, {Address: "jay", Amount: 1<<62 + 50}}
+	coinbase.hashId()
+	block := &Block{Height: 1, Transactions: []*Tx{coinbase}}
+	if err := validateCoinbase(block); err != ErrInvalidCoinbase {
+		t.Errorf("got %v for a coinbase whose outputs wrap around to the subsidy, want %v", err, ErrInvalidCoinbase)
+	}
+}
+
+func TestValidateMerkleRootDuplicateTx(t *testing.T) {
+	coinbase := makeCoinbaseTx("jay", 1, 0)
+	a, b := spendingTx(1), spendingTx(2)
+	honest := &Block{Height: 1, Transactions: []*Tx{coinbase, a, b}}
+	honest.MerkleRoot = merkleRoot(honest.Transactions)
+	honest.WitnessRoot = witnessRoot(honest.Transactions)
+	mutated := &Block{Height: 1, Transactions: []*Tx{coinbase, a, b, b}, MerkleRoot: honest.MerkleRoot, WitnessRoot: honest.WitnessRoot}
+	if merkleRoot(mutated.Transactions) != honest.MerkleRoot {
+		t.Fatal("repeating the last transaction should give the same merkle root")
+	}
+	if err := validateMerkleRoot(honest); err != nil {
+		t.Errorf("got %v for the honest block, want nil", err)
+	}
+	if err := validateMerkleRoot(mutated); err != ErrDuplicateTx {
+		t.Errorf("got %v for the block with the last transaction repeated, want %v", err, ErrDuplicateTx)
+	}
+}
+
+func TestValidateMerkleRootTamperedSignature(t *testing.T) {
+	block := &Block{Height: 1, Transactions: []*Tx{makeCoinbaseTx("jay", 1, 0), spendingTx(1)}}
+	block.MerkleRoot = merkleRoot(block.Transactions)
+	block.WitnessRoot = witnessRoot(block.Transactions)
+	block.Transactions[1].TxIns[0].Signature = "OP_2" // the id and the merkle root don't change
+	if err := validateMerkleRoot(block); err != ErrInvalidWitnessRoot {
+		t.Errorf("got %v for a block with a changed signature, want %v", err, ErrInvalidWitnessRoot)
+	}
+}
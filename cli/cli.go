@@ -5,16 +5,20 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jeyoungjung/zerocoin/blockchain"
 	"github.com/jeyoungjung/zerocoin/db"
 	explorer "github.com/jeyoungjung/zerocoin/explorer/templates"
 	"github.com/jeyoungjung/zerocoin/rest"
+	"github.com/jeyoungjung/zerocoin/utils"
 )
 
 func usage() {
 	fmt.Printf("Welcome to Zerocoin\n\n")
 	fmt.Printf("Please use the following flags:\n\n")
 	fmt.Printf("-port:		Set the PORT of the server\n")
-	fmt.Printf("-mode:		Choose between 'html' and 'rest'\n\n")
+	fmt.Printf("-mode:		Choose between 'html' and 'rest'\n")
+	fmt.Printf("-mempoolsize:	Set the most bytes of transactions the mempool holds\n")
+	fmt.Printf("-mempoolexpiry:	Set the seconds a transaction can wait in the mempool\n\n")
 	os.Exit(0)
 }
 
@@ -22,11 +26,16 @@ func Start() {
 	if len(os.Args) <= 2 { // If the there is nothing after the, go run main.go, run usage
 		usage()
 	}
-	db.InitDB()
 	port := flag.Int("port", 4000, "Set port of the server")
 	mode := flag.String("mode", "rest", "Choose between 'html' and 'rest'")
+	policy := blockchain.GetMempoolPolicy()
+	flag.IntVar(&policy.MaxSize, "mempoolsize", policy.MaxSize, "Set the most bytes of transactions the mempool holds")
+	flag.IntVar(&policy.Expiry, "mempoolexpiry", policy.Expiry, "Set the seconds a transaction can wait in the mempool")
 
 	flag.Parse()
+	utils.HandleErr(blockchain.SetMempoolPolicy(policy)) // before the saved mempool is restored, it's trimmed with the policy
+	db.InitDB()
+	blockchain.Blockchain() // restores the blockchain and the saved mempool before anyone can ask for them
 
 	switch *mode {
 	case "rest":
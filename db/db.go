@@ -1,6 +1,8 @@
 package db
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"os"
 	"strconv"
@@ -13,7 +15,18 @@ const (
 	dbName           = "blockchain"
 	checkpointBucket = "checkpoints"
 	blocksBucket     = "blocks"
+	workBucket       = "work"
+	utxoBucket       = "utxos"
+	addressBucket    = "addresses"
+	undoBucket       = "undo"
+	txBucket         = "transactions"
+	spenderBucket    = "spenders"
+	dataBucket       = "data"
+	heightBucket     = "heights"
+	mempoolBucket    = "mempool"
+	invalidBucket    = "invalid"
 	checkpoint       = "checkpoint"
+	utxoTip          = "utxoTip"
 )
 
 var db *bolt.DB
@@ -38,6 +51,26 @@ func InitDB() {
 			_, err := t.CreateBucketIfNotExists([]byte(checkpointBucket)) // creates a bucket named "checkpoints", this bucket only holds the data for the checkpoints
 			utils.HandleErr(err)
 			_, err = t.CreateBucketIfNotExists([]byte(blocksBucket)) // creates a bucket named "blocks"
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(workBucket)) // creates a bucket named "work", holds the total work of the chain ending at each block
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(utxoBucket)) // creates a bucket named "utxos", holds every unspent output
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(addressBucket)) // creates a bucket named "addresses", finds the unspent outputs of an address
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(undoBucket)) // creates a bucket named "undo", holds the outputs each block spent
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(txBucket)) // creates a bucket named "transactions", holds where each confirmed transaction is
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(spenderBucket)) // creates a bucket named "spenders", holds which confirmed transaction spent each output
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(dataBucket)) // creates a bucket named "data", finds the confirmed transactions carrying some data
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(heightBucket)) // creates a bucket named "heights", holds the hash of the block at each height
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(mempoolBucket)) // creates a bucket named "mempool", holds the transactions waiting to be confirmed
+			utils.HandleErr(err)
+			_, err = t.CreateBucketIfNotExists([]byte(invalidBucket)) // creates a bucket named "invalid", holds the hashes of stored blocks that failed to connect
 			return err
 		})
 		utils.HandleErr(err)
@@ -92,12 +125,322 @@ func CloseDatabase() {
 	db.Close()
 }
 
-// EmptyBlocksBucket deletes the current blocksbucket and creates a new one
-func EmptyBlocksBucket() {
-	db.Update(func(t *bolt.Tx) error {
-		utils.HandleErr(t.DeleteBucket([]byte(blocksBucket)))
-		_, err := t.CreateBucket([]byte(blocksBucket))
-		utils.HandleErr(err)
+// SaveInvalidBlocks marks the stored blocks with the hashes as invalid, they are kept so their descendants still have parents
+func SaveInvalidBlocks(hashes []string) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(invalidBucket))
+		for _, hash := range hashes {
+			utils.HandleErr(bucket.Put([]byte(hash), []byte{}))
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// IsInvalidBlock tells if the block with the hash was marked as invalid
+func IsInvalidBlock(hash string) bool {
+	invalid := false
+	db.View(func(t *bolt.Tx) error {
+		invalid = t.Bucket([]byte(invalidBucket)).Get([]byte(hash)) != nil
+		return nil
+	})
+	return invalid
+}
+
+// SaveChainWork saves the total work of the chain ending at the block with the hash
+func SaveChainWork(hash string, data []byte) {
+	// [hash : work] key value pair
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(workBucket))
+		return bucket.Put([]byte(hash), data)
+	})
+	utils.HandleErr(err)
+}
+
+// GetChainWork retrieves the total work of the chain ending at the block with the hash
+func GetChainWork(hash string) []byte {
+	var data []byte
+	db.View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(workBucket))
+		data = bucket.Get([]byte(hash))
+		return nil
+	})
+	return data
+}
+
+// UTxOEntry is an unspent output as it's kept in the utxoBucket
+// Key is "txID:index", and Data is the encoded output
+type UTxOEntry struct {
+	Key     string
+	Address string
+	Data    []byte
+}
+
+func addressKey(address, key string) []byte {
+	return []byte(address + "\x00" + key) // the address can be any string, so a byte that can't be typed separates them
+}
+
+// UpdateUTxOs deletes the spent outputs and saves the created outputs in one go,
+// then remembers tip as the newest block the unspent outputs are up to date with
+func UpdateUTxOs(tip string, spent, created []UTxOEntry) {
+	err := db.Update(func(t *bolt.Tx) error {
+		utxos := t.Bucket([]byte(utxoBucket))
+		addresses := t.Bucket([]byte(addressBucket))
+		for _, entry := range spent {
+			utils.HandleErr(utxos.Delete([]byte(entry.Key)))
+			utils.HandleErr(addresses.Delete(addressKey(entry.Address, entry.Key)))
+		}
+		for _, entry := range created {
+			utils.HandleErr(utxos.Put([]byte(entry.Key), entry.Data))
+			utils.HandleErr(addresses.Put(addressKey(entry.Address, entry.Key), []byte(entry.Key)))
+		}
+		return t.Bucket([]byte(checkpointBucket)).Put([]byte(utxoTip), []byte(tip))
+	})
+	utils.HandleErr(err)
+}
+
+// GetUTxOTip returns the hash of the newest block the unspent outputs are up to date with
+func GetUTxOTip() string {
+	var tip string
+	db.View(func(t *bolt.Tx) error {
+		tip = string(t.Bucket([]byte(checkpointBucket)).Get([]byte(utxoTip)))
+		return nil
+	})
+	return tip
+}
+
+// GetUTxO retrieves the unspent output with the key, nil if it doesn't exist or was spent
+func GetUTxO(key string) []byte {
+	var data []byte
+	db.View(func(t *bolt.Tx) error {
+		if v := t.Bucket([]byte(utxoBucket)).Get([]byte(key)); v != nil {
+			data = append([]byte{}, v...) // bolt's bytes are only valid inside the transaction
+		}
+		return nil
+	})
+	return data
+}
+
+// GetUTxOsByAddress retrieves every unspent output sent to the address
+func GetUTxOsByAddress(address string) [][]byte {
+	var data [][]byte
+	db.View(func(t *bolt.Tx) error {
+		utxos := t.Bucket([]byte(utxoBucket))
+		prefix := addressKey(address, "")
+		cursor := t.Bucket([]byte(addressBucket)).Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			data = append(data, append([]byte{}, utxos.Get(v)...))
+		}
+		return nil
+	})
+	return data
+}
+
+// EmptyIndexes deletes every unspent output, the transaction locations, the spenders, the data and the heights, so they can be rebuilt from the blocks
+func EmptyIndexes() {
+	err := db.Update(func(t *bolt.Tx) error {
+		for _, name := range []string{utxoBucket, addressBucket, undoBucket, txBucket, spenderBucket, dataBucket, heightBucket} {
+			utils.HandleErr(t.DeleteBucket([]byte(name)))
+			_, err := t.CreateBucket([]byte(name))
+			utils.HandleErr(err)
+		}
+		return t.Bucket([]byte(checkpointBucket)).Delete([]byte(utxoTip))
+	})
+	utils.HandleErr(err)
+}
+
+// SaveUndo saves the outputs spent by the block with the hash, so they can be brought back if the block is disconnected
+func SaveUndo(hash string, data []byte) {
+	err := db.Update(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(undoBucket)).Put([]byte(hash), data)
+	})
+	utils.HandleErr(err)
+}
+
+// GetUndo retrieves the outputs spent by the block with the hash
+func GetUndo(hash string) []byte {
+	var data []byte
+	db.View(func(t *bolt.Tx) error {
+		if v := t.Bucket([]byte(undoBucket)).Get([]byte(hash)); v != nil {
+			data = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return data
+}
+
+// SaveTxLocations saves where each transaction is, as [txID : location] key value pairs
+func SaveTxLocations(locations map[string][]byte) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(txBucket))
+		for id, data := range locations {
+			utils.HandleErr(bucket.Put([]byte(id), data))
+		}
 		return nil
 	})
+	utils.HandleErr(err)
+}
+
+// DeleteTxLocations deletes the locations of the transactions, used when their block is disconnected
+func DeleteTxLocations(ids []string) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(txBucket))
+		for _, id := range ids {
+			utils.HandleErr(bucket.Delete([]byte(id)))
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// GetTxLocation retrieves where the transaction with the id is, nil if it's not confirmed
+func GetTxLocation(id string) []byte {
+	var data []byte
+	db.View(func(t *bolt.Tx) error {
+		if v := t.Bucket([]byte(txBucket)).Get([]byte(id)); v != nil {
+			data = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return data
+}
+
+// SaveTxSpenders saves which transaction spent each output, as [txID:index : spending txID] key value pairs
+func SaveTxSpenders(spenders map[string]string) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(spenderBucket))
+		for outpoint, id := range spenders {
+			utils.HandleErr(bucket.Put([]byte(outpoint), []byte(id)))
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// DeleteTxSpenders deletes the spenders of the outputs, used when the block spending them is disconnected
+func DeleteTxSpenders(outpoints []string) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(spenderBucket))
+		for _, outpoint := range outpoints {
+			utils.HandleErr(bucket.Delete([]byte(outpoint)))
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// GetTxSpender retrieves the id of the confirmed transaction that spent the output, "" if it's not spent
+func GetTxSpender(outpoint string) string {
+	var id string
+	db.View(func(t *bolt.Tx) error {
+		id = string(t.Bucket([]byte(spenderBucket)).Get([]byte(outpoint)))
+		return nil
+	})
+	return id
+}
+
+// DataEntry is a confirmed transaction carrying Data, as it's kept in the dataBucket
+type DataEntry struct {
+	Data string
+	TxID string
+}
+
+// SaveTxData saves which transactions carry which data
+func SaveTxData(entries []DataEntry) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(dataBucket))
+		for _, entry := range entries {
+			utils.HandleErr(bucket.Put(addressKey(entry.Data, entry.TxID), []byte(entry.TxID))) // many transactions can carry the same data
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// DeleteTxData deletes the data of the transactions, used when their block is disconnected
+func DeleteTxData(entries []DataEntry) {
+	err := db.Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(dataBucket))
+		for _, entry := range entries {
+			utils.HandleErr(bucket.Delete(addressKey(entry.Data, entry.TxID)))
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// GetTxsByData retrieves the ids of every confirmed transaction carrying the data
+func GetTxsByData(data string) []string {
+	var ids []string
+	db.View(func(t *bolt.Tx) error {
+		prefix := addressKey(data, "")
+		cursor := t.Bucket([]byte(dataBucket)).Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			ids = append(ids, string(v))
+		}
+		return nil
+	})
+	return ids
+}
+
+func heightKey(height int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height)) // big endian so the keys are sorted by height
+	return key
+}
+
+// SaveBlockHeight saves the hash of the block at the height of the blockchain
+func SaveBlockHeight(height int, hash string) {
+	// [height : hash] key value pair
+	err := db.Update(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(heightBucket)).Put(heightKey(height), []byte(hash))
+	})
+	utils.HandleErr(err)
+}
+
+// DeleteBlockHeight deletes the height, used when the block at that height is disconnected
+func DeleteBlockHeight(height int) {
+	err := db.Update(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(heightBucket)).Delete(heightKey(height))
+	})
+	utils.HandleErr(err)
+}
+
+// GetHashByHeight retrieves the hash of the block at the height, "" if there is no such block
+func GetHashByHeight(height int) string {
+	var hash string
+	db.View(func(t *bolt.Tx) error {
+		hash = string(t.Bucket([]byte(heightBucket)).Get(heightKey(height)))
+		return nil
+	})
+	return hash
+}
+
+// SaveMempoolTx saves a transaction of the mempool, so it's still there after the node restarts
+func SaveMempoolTx(id string, data []byte) {
+	// [txID : tx] key value pair
+	err := db.Update(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(mempoolBucket)).Put([]byte(id), data)
+	})
+	utils.HandleErr(err)
+}
+
+// DeleteMempoolTx deletes a transaction that left the mempool
+func DeleteMempoolTx(id string) {
+	err := db.Update(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(mempoolBucket)).Delete([]byte(id))
+	})
+	utils.HandleErr(err)
+}
+
+// GetMempoolTxs retrieves every saved transaction of the mempool
+func GetMempoolTxs() [][]byte {
+	var data [][]byte
+	db.View(func(t *bolt.Tx) error {
+		return t.Bucket([]byte(mempoolBucket)).ForEach(func(k, v []byte) error {
+			data = append(data, append([]byte{}, v...))
+			return nil
+		})
+	})
+	return data
 }
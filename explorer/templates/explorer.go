@@ -8,6 +8,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jeyoungjung/zerocoin/blockchain"
+	"github.com/jeyoungjung/zerocoin/p2p"
+	"github.com/jeyoungjung/zerocoin/utils"
 )
 
 var port string
@@ -21,6 +23,18 @@ type homeData struct {
 	Blocks    []*blockchain.Block
 }
 
+type addData struct {
+	Hash  string // the hash of the document that was notarized
+	TxID  string // the transaction carrying it
+	Error string
+}
+
+type notarizeData struct {
+	Hash         string
+	Notarization *blockchain.Notarization
+	Error        string
+}
+
 var templates *template.Template
 
 func home(rw http.ResponseWriter, r *http.Request) {
@@ -33,11 +47,27 @@ func add(rw http.ResponseWriter, r *http.Request) {
 	case "GET":
 		templates.ExecuteTemplate(rw, "add", nil)
 	case "POST":
-		// r.ParseForm()
-		// data := r.Form.Get("blockdata")
-		// blockchain.Blockchain().AddBlock()
-		http.Redirect(rw, r, "/", http.StatusPermanentRedirect)
+		r.ParseForm()
+		hash := utils.HashBytes([]byte(r.Form.Get("document"))) // only the hash goes on the chain
+		newTx, err := blockchain.Mempool().Notarize(hash, 0, 0)
+		if err != nil {
+			templates.ExecuteTemplate(rw, "add", addData{Hash: hash, Error: err.Error()})
+			return
+		}
+		p2p.BroadcastNewTx(newTx)
+		templates.ExecuteTemplate(rw, "add", addData{Hash: hash, TxID: newTx.ID})
+	}
+}
+
+// notarization shows when a document hash was put on the chain, the same as GET /notarize/{hash} of the rest api
+func notarization(rw http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	found, err := blockchain.FindNotarization(blockchain.Blockchain(), hash)
+	data := notarizeData{Hash: hash, Notarization: found}
+	if err != nil {
+		data.Error = err.Error()
 	}
+	templates.ExecuteTemplate(rw, "notarize", data)
 }
 
 func Start(explorerPort int) {
@@ -47,6 +77,7 @@ func Start(explorerPort int) {
 	templates = template.Must(templates.ParseGlob(templateDir + "partials/*.gohtml"))
 	handler.HandleFunc("/", home)
 	handler.HandleFunc("/add", add)
+	handler.HandleFunc("/notarize/{hash:[a-f0-9]+}", notarization)
 	fmt.Printf("Listening on http://localhost%s\n", port)
 	log.Fatal(http.ListenAndServe(port, handler))
 }
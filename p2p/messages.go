@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jeyoungjung/zerocoin/blockchain"
 	"github.com/jeyoungjung/zerocoin/utils"
@@ -19,6 +20,7 @@ const (
 	MessageNewBlockNotify
 	MessageNewTxNotify
 	MessageNewPeerNotify
+	MessageTime
 )
 
 type Message struct {
@@ -44,23 +46,27 @@ func sendNewestBlock(p *peer) {
 	p.inbox <- m // send the message to the channel, next funtion would be write()
 }
 
+// sendTime tells the peer what time it is for us, so it can tell how far off its clock is from the network
+func sendTime(p *peer) {
+	m := makeMessage(MessageTime, time.Now().Unix())
+	p.inbox <- m
+}
+
 // handleMsg handles the incoming message accordingly to their MessageKind
 func handleMsg(m *Message, p *peer) {
 	switch m.Kind {
 	case MessageNewestBlock:
 		fmt.Printf("Received the newest block from %s\n", p.key)
 		var payload blockchain.Block
-		utils.HandleErr(json.Unmarshal(m.Payload, &payload))               // payload holds the newest block for port 4000 (the sender's blockchain)
-		b, err := blockchain.FindBlock(blockchain.Blockchain().NewestHash) // this function gets the height of the current port's blockchain
-		utils.HandleErr(err)
-		if payload.Height >= b.Height { // if the height of the sender's blockchain is higher than the current port's blockchain
-			// it means that the sender has an updated blockchain that the current port is not up to date with
-			// in that case, request every block from the sender, to update the current port's blockchain
+		utils.HandleErr(json.Unmarshal(m.Payload, &payload))          // payload holds the newest block for port 4000 (the sender's blockchain)
+		if _, err := blockchain.FindBlock(payload.Hash); err != nil { // if we don't have the sender's newest block
+			// it means that the sender has blocks that the current port doesn't know about
+			// in that case, request every block from the sender, the blockchain with the most work will be kept
 			fmt.Printf("Requesting all blocks from %s\n", p.key)
 			requestAllBlocks(p)
-		} else { // else, it means that the current port has more up to date blockchain, so give the sender
-			// the current newest blockchain.
-			// then that port would run this if statement again to find out that the height is different,
+		} else if blockchain.HasMoreWork(blockchain.Blockchain(), payload.Hash) { // else, if the current port's blockchain has more work, give the sender
+			// the current newest block.
+			// then that port would run this if statement again to find out that it doesn't know the block,
 			// and would requestAllBlocks form this port.
 			sendNewestBlock(p)
 		}
@@ -71,21 +77,49 @@ func handleMsg(m *Message, p *peer) {
 		fmt.Printf("Received all the blocks from %s\n", p.key)
 		var payload []*blockchain.Block
 		utils.HandleErr(json.Unmarshal(m.Payload, &payload))
-		blockchain.Blockchain().Replace(payload)
+		if err := blockchain.Blockchain().AddPeerBlocks(payload); err != nil {
+			fmt.Printf("Rejected blocks from %s: %s\n", p.key, err)
+			break
+		}
+		if len(payload) > 0 && blockchain.HasMoreWork(blockchain.Blockchain(), payload[0].Hash) { // the sender's chain lost,
+			// so it needs ours. the newest block comes first
+			sendNewestBlock(p)
+		}
 	case MessageNewBlockNotify:
 		var payload *blockchain.Block
 		utils.HandleErr(json.Unmarshal(m.Payload, &payload))
-		blockchain.Blockchain().AddPeerBlock(payload)
+		err := blockchain.Blockchain().AddPeerBlock(payload)
+		if err == blockchain.ErrOrphanBlock { // we are missing the blocks before it, so get the sender's whole blockchain
+			requestAllBlocks(p)
+			break
+		}
+		if err != nil { // invalid blocks stop here, they are not relayed
+			fmt.Printf("Rejected block from %s: %s\n", p.key, err)
+			break
+		}
+		relayNewBlock(payload, p) // the block is valid and new to us, so the other peers might not have it either
 	case MessageNewTxNotify:
 		var payload *blockchain.Tx
 		utils.HandleErr(json.Unmarshal(m.Payload, &payload))
-		blockchain.Mempool().AddPeerTx(payload)
+		err := blockchain.Mempool().AddPeerTx(payload)
+		if err == blockchain.ErrTxKnown { // we already have it, so we already sent it to our peers too
+			break
+		}
+		if err != nil { // invalid transactions stop here, they are not relayed
+			fmt.Printf("Rejected transaction from %s: %s\n", p.key, err)
+			break
+		}
+		relayNewTx(payload, p)
 	case MessageNewPeerNotify:
 		var payload string
 		utils.HandleErr(json.Unmarshal(m.Payload, &payload))
 		parts := strings.Split(payload, ":")
 		AddPeer(parts[0], parts[1], parts[2], false) // the broadcast part of the AddPeer() is false because the
 		// peer is beign broadcasted right now, doesnt have to be broadcasted again
+	case MessageTime:
+		var payload int
+		utils.HandleErr(json.Unmarshal(m.Payload, &payload))
+		blockchain.AddTimeSample(p.key, payload)
 	}
 }
 
@@ -24,7 +24,8 @@ func Upgrade(rw http.ResponseWriter, r *http.Request) {
 	fmt.Printf(":%s wants an upgrade\n", openPort)
 	conn, err := upgrader.Upgrade(rw, r, nil) // Upgrades http to ws
 	utils.HandleErr(err)
-	initPeer(conn, ip, openPort)
+	p := initPeer(conn, ip, openPort)
+	sendTime(p) // both sides of the connection send their time, so both know the other's clock
 }
 
 // AddPeer takes in the its Peer's port, and adds it to the Peers map
@@ -34,6 +35,7 @@ func AddPeer(address, port, openPort string, broadcast bool) {
 	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s:%s/ws?openPort=%s", address, port, openPort), nil) // it is going to call the Upgrade function, which will upgrade that page to Websocket
 	utils.HandleErr(err)
 	p := initPeer(conn, address, port)
+	sendTime(p)
 	if broadcast { // if the peer is 100% new to the network, and needs to be broadcasted
 		broadcastNewPeer(p)
 	}
@@ -50,6 +52,17 @@ func BroadcastNewBlock(b *blockchain.Block) {
 	}
 }
 
+// relayNewBlock sends a block received from a peer to every other peer
+func relayNewBlock(b *blockchain.Block, from *peer) {
+	Peers.m.Lock()
+	defer Peers.m.Unlock()
+	for key, p := range Peers.v {
+		if key != from.key { // the sender already has the block
+			notifyNewBlock(b, p)
+		}
+	}
+}
+
 // BroadcastNewTx broadcasts the new transaction to other peers
 func BroadcastNewTx(tx *blockchain.Tx) {
 	Peers.m.Lock()
@@ -59,6 +72,17 @@ func BroadcastNewTx(tx *blockchain.Tx) {
 	}
 }
 
+// relayNewTx sends a transaction received from a peer to every other peer
+func relayNewTx(tx *blockchain.Tx, from *peer) {
+	Peers.m.Lock()
+	defer Peers.m.Unlock()
+	for key, p := range Peers.v {
+		if key != from.key { // the sender already has the transaction
+			notifyNewTx(tx, p)
+		}
+	}
+}
+
 // broadcastNewPeer broadcasts the new peer to other peers
 func broadcastNewPeer(newPeer *peer) {
 	for key, p := range Peers.v {
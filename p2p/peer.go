@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/gorilla/websocket"
+	"github.com/jeyoungjung/zerocoin/blockchain"
 )
 
 type peers struct { // made a struct so we can use mutex
@@ -71,7 +72,8 @@ func (p *peer) close() {
 	Peers.m.Lock()         // locks it so that no other functions would be able to read it while this function is running
 	defer Peers.m.Unlock() // is unlocked when the function is done running
 	p.conn.Close()
-	delete(Peers.v, p.key) // delete the peer that disconnected from the map of peers
+	delete(Peers.v, p.key)             // delete the peer that disconnected from the map of peers
+	blockchain.RemoveTimeSample(p.key) // its clock doesn't count for the network time anymore
 }
 
 // GetPeers returns all the peers 
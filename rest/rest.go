@@ -2,9 +2,12 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/jeyoungjung/zerocoin/blockchain"
@@ -40,6 +43,10 @@ func documentation(rw http.ResponseWriter, r *http.Request) {
 			Method:      "POST",
 			Description: "Add A Block",
 			Payload:     "data:string",
+		}, {
+			URL:         url("/blocks?from={height}&limit={n}"),
+			Method:      "GET",
+			Description: "See n Blocks going down from the height, and the from of the next page",
 		}, {
 			URL:         url("/status"),
 			Method:      "GET",
@@ -48,10 +55,89 @@ func documentation(rw http.ResponseWriter, r *http.Request) {
 			URL:         url("/blocks/{hash}"),
 			Method:      "GET",
 			Description: "See A Block",
+		}, {
+			URL:         url("/blocks/height/{height}"),
+			Method:      "GET",
+			Description: "See A Block at a Height",
 		}, {
 			URL:         url("/balance/{address}"),
 			Method:      "GET",
-			Description: "Get TxOuts for an Address",
+			Description: "Get TxOuts for an Address (?total=true for the balance, ?immature=true for coinbase TxOuts that can't be spent yet)",
+		}, {
+			URL:         url("/transactions"),
+			Method:      "POST",
+			Description: "Send coins from the wallet",
+			Payload:     "to:string, amount:int and/or outputs:[{address:string, amount:int, script:string}], fee:int or feeRate:int, lockTime:int, lockBlocks:int, lockSeconds:int",
+		}, {
+			URL:         url("/scripts"),
+			Method:      "POST",
+			Description: "Make a Standard Locking Script and its Address, to pay with the outputs of a transaction",
+			Payload:     "type:pubKeyHash|multisig|hashLock|htlc, pubKeys:[string], required:int (multisig), hash:string (hashLock, htlc), timeout:int (htlc)",
+		}, {
+			URL:         url("/multisig"),
+			Method:      "POST",
+			Description: "Make a Multisig Address that needs Required Signatures of the Public Keys",
+			Payload:     "pubKeys:[string], required:int",
+		}, {
+			URL:         url("/multisig/{address}/spend"),
+			Method:      "POST",
+			Description: "Make an Unsigned Transaction spending the Coins of a Multisig Address",
+			Payload:     "the same as /transactions",
+		}, {
+			URL:         url("/multisig/sign"),
+			Method:      "POST",
+			Description: "Add the Signatures of this Node's Wallet to a Partial Transaction",
+			Payload:     "tx:object, signatures:[[string]] (what /multisig/{address}/spend or another cosigner gave)",
+		}, {
+			URL:         url("/multisig/broadcast"),
+			Method:      "POST",
+			Description: "Send a Partial Transaction once it has Enough Signatures",
+			Payload:     "tx:object, signatures:[[string]]",
+		}, {
+			URL:         url("/htlc"),
+			Method:      "POST",
+			Description: "Lock Coins of the wallet to a Hash Time-Locked Contract, for an Atomic Swap",
+			Payload:     "recipient:string, hash:string, timeout:int (a height or a unix time), amount:int, fee:int or feeRate:int",
+		}, {
+			URL:         url("/htlc/{txid}/{index}"),
+			Method:      "GET",
+			Description: "See an HTLC and how it was Spent, with the Preimage once it's Redeemed",
+		}, {
+			URL:         url("/htlc/{txid}/{index}/redeem"),
+			Method:      "POST",
+			Description: "Take an HTLC to the wallet by Revealing the Preimage of its Hash",
+			Payload:     "preimage:string, fee:int or feeRate:int",
+		}, {
+			URL:         url("/htlc/{txid}/{index}/refund"),
+			Method:      "POST",
+			Description: "Take an HTLC back to the wallet once its Timeout has Passed",
+			Payload:     "fee:int or feeRate:int (optional)",
+		}, {
+			URL:         url("/notarize"),
+			Method:      "POST",
+			Description: "Put the Hash of a Document on the Chain in a Data Output",
+			Payload:     "hash:string or document:string (hashed for you), fee:int or feeRate:int (optional)",
+		}, {
+			URL:         url("/notarize/{hash}"),
+			Method:      "GET",
+			Description: "See Which Block Timestamped a Document Hash, with its Merkle Proof",
+		}, {
+			URL:         url("/transactions/{id}"),
+			Method:      "GET",
+			Description: "See A Transaction and its Confirmations",
+		}, {
+			URL:         url("/transactions/{id}/proof"),
+			Method:      "GET",
+			Description: "Get the Merkle Proof that A Transaction is in its Block",
+		}, {
+			URL:         url("/transactions/{id}/bump"),
+			Method:      "POST",
+			Description: "Replace A Stuck Transaction from the wallet with a Higher Fee",
+			Payload:     "fee:int or feeRate:int (both optional, the least fee that replaces it is used otherwise)",
+		}, {
+			URL:         url("/supply"),
+			Method:      "GET",
+			Description: "See the Coins Issued and Remaining",
 		}, {
 			URL:         url("/ws"),
 			Method:      "GET",
@@ -69,16 +155,62 @@ func documentation(rw http.ResponseWriter, r *http.Request) {
 // It has to be a struct decode something.
 // "error: cannot unmarshal object into Go value of type string" if it was `var addBlockBody string` instead of a struct
 
+const (
+	defaultBlocksLimit int = 20  // blocks per page when only from is given
+	maxBlocksLimit     int = 100 // the most blocks a page can have
+)
+
+type blocksPageResponse struct {
+	Blocks []*blockchain.Block `json:"blocks"`
+	Next   int                 `json:"next,omitempty"` // the from for the next page, missing on the last page
+}
+
+// blocksPage returns a page of blocks when from or limit is in the query
+// "http://localhost:4000/blocks?from=100&limit=10" returns the blocks at heights 100 to 91, and next is 90
+func blocksPage(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, limit := blockchain.Blockchain().Height, defaultBlocksLimit
+	var err error
+	if query.Get("from") != "" {
+		from, err = strconv.Atoi(query.Get("from"))
+	}
+	if err == nil && query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+	}
+	if err != nil || from < 0 || limit <= 0 {
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(errorResponse{"from and limit have to be positive numbers"})
+		return
+	}
+	if limit > maxBlocksLimit {
+		limit = maxBlocksLimit
+	}
+	page := blocksPageResponse{Blocks: blockchain.GetBlocksFrom(blockchain.Blockchain(), from, limit)}
+	if next := from - limit; next > 0 {
+		page.Next = next
+	}
+	json.NewEncoder(rw).Encode(page)
+}
+
 func blocks(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
+		if r.URL.Query().Has("from") || r.URL.Query().Has("limit") {
+			blocksPage(rw, r)
+			return
+		}
 		json.NewEncoder(rw).Encode(blockchain.GetBlockchain(blockchain.Blockchain())) //converts the blockchain data to json
 	case "POST":
 		//var addBlockBody addBlockBody
 		//utils.HandleErr(json.NewDecoder(r.Body).Decode(&addBlockBody)) // this function returns an error, hence the utils.HandleErr()
 		// Explanation: new decoder is made, the the r.body (consisting of data like "second block") is decoded into the actual addBlockBody
 		// https://stackoverflow.com/questions/21197239/decoding-json-using-json-unmarshal-vs-json-newdecoder-decode
-		newBlock := blockchain.Blockchain().AddBlock()
+		newBlock, err := blockchain.Blockchain().AddBlock()
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
 		p2p.BroadcastNewBlock(newBlock)
 		rw.WriteHeader(http.StatusCreated)
 	}
@@ -100,6 +232,24 @@ func block(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func blockByHeight(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	encoder := json.NewEncoder(rw)
+	height, err := strconv.Atoi(vars["height"])
+	if err != nil { // the route only matches digits, but there can be too many of them
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{"height has to be a number that fits in an int"})
+		return
+	}
+	block, err := blockchain.FindBlockByHeight(height)
+	if err == blockchain.ErrBlockNotFound {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{fmt.Sprint(err)})
+	} else {
+		encoder.Encode(block)
+	}
+}
+
 func jsonContentTypeMiddleware(next http.Handler) http.Handler { // this function is a middleware that sets the content-type to be json,
 	// this let's the browser know that the file we are passing is json.
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -113,8 +263,9 @@ func status(rw http.ResponseWriter, r *http.Request) {
 }
 
 type balanceResponse struct {
-	Address string `json:"address"`
-	Balance int    `json:"balance"`
+	Address  string `json:"address"`
+	Balance  int    `json:"balance"`
+	Immature int    `json:"immature"` // coinbase money that can't be spent yet, not part of the balance
 }
 
 func loggerMiddleware(next http.Handler) http.Handler { // just logs which url it's on
@@ -128,10 +279,12 @@ func balance(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 	total := r.URL.Query().Get("total")
-	switch total {
-	case "true": // if "http://localhost:4000/balance/zero?total=true" return the total balance
-		amount := blockchain.TotalBalanceByAddress(address, blockchain.Blockchain())
-		json.NewEncoder(rw).Encode(balanceResponse{address, amount})
+	switch {
+	case total == "true": // if "http://localhost:4000/balance/zero?total=true" return the total balance
+		amount, immature := blockchain.TotalBalanceByAddress(address, blockchain.Blockchain())
+		json.NewEncoder(rw).Encode(balanceResponse{address, amount, immature})
+	case r.URL.Query().Get("immature") == "true": // "http://localhost:4000/balance/zero?immature=true" returns the coinbase receipts that can't be spent yet
+		utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.ImmatureUTxOutsByAddress(address, blockchain.Blockchain())))
 	default: // if "http://localhost:4000/balance/zero" return receipts for each transactions
 		utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.UTxOutsByAddress(address, blockchain.Blockchain())))
 	}
@@ -142,21 +295,388 @@ func mempool(rw http.ResponseWriter, r *http.Request) {
 }
 
 type addTxPayload struct {
-	To     string
-	Amount int
+	To          string
+	Amount      int
+	Outputs     []*blockchain.TxOut // more addresses to pay in the same transaction, each with an "address" and an "amount"
+	Fee         int                 // a fixed fee for the miner
+	FeeRate     int                 // or the fee for every 1000 bytes of the transaction
+	LockTime    int                 // the block height (or unix time) it can't be confirmed before
+	LockBlocks  int                 // how many blocks the coins it spends have to be confirmed for first
+	LockSeconds int                 // or how many seconds
+}
+
+func (p addTxPayload) payments() []*blockchain.TxOut {
+	payments := p.Outputs
+	if p.To != "" {
+		payments = append([]*blockchain.TxOut{{Address: p.To, Amount: p.Amount}}, payments...)
+	}
+	return payments
+}
+
+func (p addTxPayload) locks() blockchain.TxLocks {
+	return blockchain.TxLocks{
+		LockTime:    p.LockTime,
+		LockBlocks:  p.LockBlocks,
+		LockSeconds: p.LockSeconds,
+	}
 }
 
 func transactions(rw http.ResponseWriter, r *http.Request) { // this is a POST only function
-	// the payload consists of "To" and "Amount" which will send that much amount to that someone.
-	// if there is an error, it means that theres not enough money.
+	// the payload consists of "To" and "Amount" which will send that much amount to that someone,
+	// and/or "Outputs" to pay many addresses at once, with a single change output,
+	// and optionally "Fee" or "FeeRate" which is left for the miner.
+	// "LockTime" is a block height (or a unix time) it can't be confirmed before,
+	// "LockBlocks" and "LockSeconds" are how long the coins it spends have to be confirmed for first.
+	// if there is an error, it's usually that theres not enough money.
 	var payload addTxPayload
-	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
-	newTx, err := blockchain.Mempool().AddTx(payload.To, payload.Amount)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	newTx, err := blockchain.Mempool().AddTx(payload.payments(), payload.Fee, payload.FeeRate, payload.locks())
 	if err != nil {
-		json.NewEncoder(rw).Encode(errorResponse{"not enough funds"})
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
 		return
 	}
 	p2p.BroadcastNewTx(newTx) // sends this transaction to other peers
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(newTx) // the id is needed to look it up or bump it later
+}
+
+type scriptResponse struct {
+	Script  string `json:"script"`
+	Address string `json:"address"`
+}
+
+// script makes one of the standard locking scripts, an output paying it needs both the script and the address
+func script(rw http.ResponseWriter, r *http.Request) {
+	var template blockchain.ScriptTemplate
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	lockingScript, err := template.Script()
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	encoder.Encode(scriptResponse{lockingScript, blockchain.ScriptAddress(lockingScript)})
+}
+
+type multisigPayload struct {
+	PubKeys  []string `json:"pubKeys"`
+	Required int      `json:"required"`
+}
+
+// multisig makes the address of required signatures out of the public keys,
+// anyone can pay it with an output that has the script
+func multisig(rw http.ResponseWriter, r *http.Request) {
+	var payload multisigPayload
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	template := blockchain.ScriptTemplate{Type: "multisig", PubKeys: payload.PubKeys, Required: payload.Required}
+	lockingScript, err := template.Script()
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(scriptResponse{lockingScript, blockchain.ScriptAddress(lockingScript)})
+}
+
+// multisigSpend makes a transaction spending the coins of the multisig address, with the same payload as /transactions.
+// it has no signatures yet, it goes to /multisig/sign of every cosigner's node and then to /multisig/broadcast
+func multisigSpend(rw http.ResponseWriter, r *http.Request) {
+	var payload addTxPayload
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	address := mux.Vars(r)["address"]
+	partialTx, err := blockchain.Mempool().MakeMultisigTx(address, payload.payments(), payload.Fee, payload.FeeRate, payload.locks())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(partialTx)
+}
+
+// multisigSign adds the signatures of this node's wallet to the partial transaction and gives it back
+func multisigSign(rw http.ResponseWriter, r *http.Request) {
+	var partialTx blockchain.PartialTx
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&partialTx); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	if err := blockchain.Mempool().SignPartialTx(&partialTx); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	encoder.Encode(partialTx)
+}
+
+// multisigBroadcast sends the partial transaction once every input has enough signatures
+func multisigBroadcast(rw http.ResponseWriter, r *http.Request) {
+	var partialTx blockchain.PartialTx
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&partialTx); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	newTx, err := blockchain.Mempool().AddPartialTx(&partialTx)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	p2p.BroadcastNewTx(newTx)
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(newTx)
+}
+
+type addHTLCPayload struct {
+	Recipient string // the public key that can redeem it
+	Hash      string // the SHA-256 of the preimage the recipient has to reveal
+	Timeout   int    // the block height (or unix time) from which we can take it back
+	Amount    int
+	Fee       int
+	FeeRate   int
+}
+
+type htlcResponse struct {
+	HTLC *blockchain.HTLC `json:"htlc"`
+	Tx   *blockchain.Tx   `json:"tx"`
+}
+
+// htlcs locks coins of the wallet to an htlc, the other side of a swap has to see it confirmed before locking theirs
+func htlcs(rw http.ResponseWriter, r *http.Request) {
+	var payload addHTLCPayload
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	htlc, newTx, err := blockchain.Mempool().AddHTLC(payload.Recipient, payload.Hash, payload.Timeout, payload.Amount, payload.Fee, payload.FeeRate)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	p2p.BroadcastNewTx(newTx)
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(htlcResponse{htlc, newTx})
+}
+
+var errInvalidIndex = errors.New("index has to be a number that fits in an int")
+
+// htlcOutpoint reads the txid and the index of the htlc output from the url.
+// the route only matches digits, but there can be too many of them, and any other index would be the wrong output
+func htlcOutpoint(r *http.Request) (string, int, error) {
+	vars := mux.Vars(r)
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		return "", 0, errInvalidIndex
+	}
+	return vars["id"], index, nil
+}
+
+// htlc shows the htlc output, and the preimage once the recipient redeemed it
+func htlc(rw http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(rw)
+	id, index, err := htlcOutpoint(r)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	found, err := blockchain.FindHTLC(blockchain.Blockchain(), id, index)
+	if err == blockchain.ErrTxNotFound {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	encoder.Encode(found)
+}
+
+type spendHTLCPayload struct {
+	Preimage string // only to redeem
+	Fee      int
+	FeeRate  int
+}
+
+// spendHTLC redeems the htlc with the preimage if redeem is true, or refunds it to us after its timeout
+func spendHTLC(redeem bool) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var payload spendHTLCPayload
+		encoder := json.NewEncoder(rw)
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF { // the body can be left out to refund
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(errorResponse{err.Error()})
+			return
+		}
+		id, index, err := htlcOutpoint(r)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(errorResponse{err.Error()})
+			return
+		}
+		var newTx *blockchain.Tx
+		if redeem {
+			newTx, err = blockchain.Mempool().RedeemHTLC(id, index, payload.Preimage, payload.Fee, payload.FeeRate)
+		} else {
+			newTx, err = blockchain.Mempool().RefundHTLC(id, index, payload.Fee, payload.FeeRate)
+		}
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(errorResponse{err.Error()})
+			return
+		}
+		p2p.BroadcastNewTx(newTx)
+		rw.WriteHeader(http.StatusCreated)
+		encoder.Encode(newTx)
+	}
+}
+
+type notarizePayload struct {
+	Hash     string // the SHA-256 of the document
+	Document string // or the document itself, only its hash goes on the chain
+	Fee      int
+	FeeRate  int
+}
+
+type notarizeResponse struct {
+	Hash string         `json:"hash"`
+	Tx   *blockchain.Tx `json:"tx"`
+}
+
+// notarize puts a document hash on the chain, GET /notarize/{hash} proves when once it's confirmed
+func notarize(rw http.ResponseWriter, r *http.Request) {
+	var payload notarizePayload
+	encoder := json.NewEncoder(rw)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	hash := payload.Hash
+	if hash == "" && payload.Document != "" {
+		hash = utils.HashBytes([]byte(payload.Document))
+	}
+	newTx, err := blockchain.Mempool().Notarize(hash, payload.Fee, payload.FeeRate)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	p2p.BroadcastNewTx(newTx)
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(notarizeResponse{hash, newTx})
+}
+
+func notarization(rw http.ResponseWriter, r *http.Request) {
+	found, err := blockchain.FindNotarization(blockchain.Blockchain(), mux.Vars(r)["hash"])
+	encoder := json.NewEncoder(rw)
+	if err == blockchain.ErrNotNotarized {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	encoder.Encode(found)
+}
+
+func transaction(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	status, err := blockchain.FindTxStatus(blockchain.Blockchain(), id)
+	encoder := json.NewEncoder(rw)
+	if err == blockchain.ErrTxNotFound {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{fmt.Sprint(err)})
+	} else {
+		encoder.Encode(status)
+	}
+}
+
+type bumpTxPayload struct {
+	Fee     int // the new fee has to be at least this
+	FeeRate int // and at least this much for every 1000 bytes
+}
+
+type bumpTxResponse struct {
+	Tx      *blockchain.Tx `json:"tx"`
+	Evicted []string       `json:"evicted,omitempty"` // the ids of the transactions that spent the old one's outputs, they have to be made again
+}
+
+func bumpTransaction(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var payload bumpTxPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF { // no body just means the smallest bump
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	newTx, evicted, err := blockchain.Mempool().BumpTx(id, payload.Fee, payload.FeeRate)
+	encoder := json.NewEncoder(rw)
+	if err == blockchain.ErrTxNotFound {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(errorResponse{err.Error()})
+		return
+	}
+	p2p.BroadcastNewTx(newTx) // peers replace the old transaction too
+	rw.WriteHeader(http.StatusCreated)
+	encoder.Encode(bumpTxResponse{newTx, evicted})
+}
+
+func transactionProof(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	proof, err := blockchain.TxMerkleProof(blockchain.Blockchain(), id)
+	encoder := json.NewEncoder(rw)
+	if err == blockchain.ErrTxNotFound {
+		rw.WriteHeader(http.StatusNotFound)
+		encoder.Encode(errorResponse{fmt.Sprint(err)})
+	} else {
+		encoder.Encode(proof)
+	}
+}
+
+func supply(rw http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.GetSupply(blockchain.Blockchain())))
 }
 
 type myWalletResponse struct {
@@ -197,10 +717,26 @@ func Start(startPort int) {
 	router.HandleFunc("/blocks", blocks).Methods("GET", "POST")
 	router.HandleFunc("/balance/{address}", balance).Methods("GET")
 	router.HandleFunc("/mempool", mempool).Methods("GET")
+	router.HandleFunc("/supply", supply).Methods("GET")
 	router.HandleFunc("/transactions", transactions).Methods("POST")
+	router.HandleFunc("/transactions/{id:[a-f0-9]+}", transaction).Methods("GET")
+	router.HandleFunc("/transactions/{id:[a-f0-9]+}/proof", transactionProof).Methods("GET")
+	router.HandleFunc("/transactions/{id:[a-f0-9]+}/bump", bumpTransaction).Methods("POST")
+	router.HandleFunc("/scripts", script).Methods("POST")
+	router.HandleFunc("/multisig", multisig).Methods("POST")
+	router.HandleFunc("/htlc", htlcs).Methods("POST")
+	router.HandleFunc("/htlc/{id:[a-f0-9]+}/{index:[0-9]+}", htlc).Methods("GET")
+	router.HandleFunc("/htlc/{id:[a-f0-9]+}/{index:[0-9]+}/redeem", spendHTLC(true)).Methods("POST")
+	router.HandleFunc("/htlc/{id:[a-f0-9]+}/{index:[0-9]+}/refund", spendHTLC(false)).Methods("POST")
+	router.HandleFunc("/notarize", notarize).Methods("POST")
+	router.HandleFunc("/notarize/{hash:[a-f0-9]+}", notarization).Methods("GET")
+	router.HandleFunc("/multisig/sign", multisigSign).Methods("POST")
+	router.HandleFunc("/multisig/broadcast", multisigBroadcast).Methods("POST")
+	router.HandleFunc("/multisig/{address:[a-f0-9]+}/spend", multisigSpend).Methods("POST")
 	router.HandleFunc("/wallet", myWallet).Methods("GET")
 	router.HandleFunc("/ws", p2p.Upgrade).Methods("GET")
 	router.HandleFunc("/peers", peers).Methods("GET", "POST")
+	router.HandleFunc("/blocks/height/{height:[0-9]+}", blockByHeight).Methods("GET")
 	router.HandleFunc("/blocks/{hash:[a-f0-9]+}", block).Methods("GET") // means that the hash can have values from a-f and 0-9 (hexadecimal)
 	fmt.Printf("Listening on http://localhost%s\n", port)
 	log.Fatal(http.ListenAndServe(port, router))
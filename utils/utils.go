@@ -35,6 +35,12 @@ func Hash(i interface{}) string {
 	return fmt.Sprintf("%x", hash)   // returns the value in hexadecimal characters but in string format
 }
 
+// HashBytes hashes the bytes and returns the hash in hexadecimal characters
+func HashBytes(data []byte) string {
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("%x", hash)
+}
+
 func StringSplitter(s string, sep string, i int) string {
 	r := strings.Split(s, sep)
 	if len(r)-1 < i {
@@ -15,6 +15,7 @@ import (
 
 const (
 	fileName string = "zerocoin.wallet"
+	intSize  int    = 32 // bytes in a P-256 number
 )
 
 var w *wallet
@@ -72,18 +73,22 @@ func addressFromKey(key *ecdsa.PrivateKey) string {
 	// if you do address := key.PublicKey it will include the eliptic curve as an element, and the X and Y would be divided into 2
 	// (Look at the key.PublicKey struct to be reminded)
 	// by appending the X and Y we have 1 string that can be used as a publicKey.
-	return encodeBigInts(key.X.Bytes(), key.Y.Bytes())
+	return encodeBigInts(key.X, key.Y)
 }
 
 func Sign(payload string, w *wallet) string { // for signature you will need: the data you want to sign (payload) + privateKey
 	payloadBytes := decodeString(payload)
 	r, s, err := ecdsa.Sign(rand.Reader, w.privateKey, payloadBytes)
 	utils.HandleErr(err)
-	return encodeBigInts(r.Bytes(), s.Bytes())
+	return encodeBigInts(r, s)
 }
 
-func encodeBigInts(a, b []byte) string {
-	z := append(a, b...)
+// encodeBigInts writes both numbers as 32 bytes each, so restoreBigInts can always split them in the middle
+// (big.Int's Bytes() drops leading zeros, which would move the middle)
+func encodeBigInts(a, b *big.Int) string {
+	z := make([]byte, 2*intSize)
+	a.FillBytes(z[:intSize])
+	b.FillBytes(z[intSize:])
 	return fmt.Sprintf("%x", z)
 }
 
@@ -109,17 +114,28 @@ func decodeString(payload string) []byte {
 
 // Verify checks if the transaction is the owner's
 // for verification you will need, the signature, payload and publicKey (address)
+// since the signature can come from a peer, anything that can't be decoded is just not verified
 func Verify(signature, payload, address string) bool {
 	r, s, err := restoreBigInts(signature) // changed the string into bigInts
-	utils.HandleErr(err)
+	if err != nil {
+		return false
+	}
 	x, y, err := restoreBigInts(address) // changed the string into bigInts
-	utils.HandleErr(err)
+	if err != nil {
+		return false
+	}
 	publicKey := ecdsa.PublicKey{
 		Curve: elliptic.P256(), // we are using p256 curve
 		X:     x,
 		Y:     y,
 	}
-	payloadBytes := decodeString(payload)
+	if !publicKey.Curve.IsOnCurve(x, y) {
+		return false
+	}
+	payloadBytes, err := hex.DecodeString(payload)
+	if err != nil {
+		return false
+	}
 	ok := ecdsa.Verify(&publicKey, payloadBytes, r, s)
 	return ok
 }